@@ -0,0 +1,345 @@
+// Package book holds what the programs that print books share: the
+// sections a -book file describes, the sudokus each volume takes from the
+// store, and the pdf layouts of generatepdf.go and mix.go, which serve.go
+// draws as well.
+package book
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+// Game is a sudoku of a book
+type Game struct {
+	ID       int64 // in its table, 0 for fixtures
+	Game     string
+	Solution string
+	Variant  string // classic, killer or samurai
+	Size     int
+	Cages    string // a killer's, as sudoku.FormatCages writes them
+	Symmetry sql.NullString
+	Score    sql.NullInt64
+}
+
+// Shape is the shape of the game, classic 9 x 9 for a game without a
+// variant
+func (g Game) Shape() sudoku.Shape {
+	shape, err := sudoku.NewShape(g.Variant, g.Size)
+	if err != nil {
+		shape, _ = sudoku.NewShape("classic", 9)
+	}
+	return shape
+}
+
+// CageText lists a killer's cages for a reader that can't see them, each
+// sum with its cells by printed row and column, like 10 in r1c1 r2c1; "" for
+// the other variants
+func (g Game) CageText() string {
+	cages, err := sudoku.ParseCages(g.Cages)
+	if err != nil || len(cages) == 0 {
+		return ""
+	}
+	size := g.Shape().Size
+	parts := make([]string, len(cages))
+	for k, cage := range cages {
+		cells := make([]string, len(cage.Cells))
+		for i, c := range cage.Cells {
+			cells[i] = fmt.Sprintf("r%dc%d", c%size+1, c/size+1)
+		}
+		parts[k] = fmt.Sprintf("%d in %s", cage.Sum, strings.Join(cells, " "))
+	}
+	return "Cages: " + strings.Join(parts, ", ") + "."
+}
+
+var (
+	// the tables hold fewer sudokus than the volume needs
+	ErrNotEnoughPuzzles = errors.New("not enough puzzles")
+	// the pdf can't be drawn or written
+	ErrRender = errors.New("rendering the pdf")
+)
+
+// Section is a part of the book: its puzzles and then their solutions,
+// each after a title page
+type Section struct {
+	Title      string `json:"title"` // "Easy Sudoku" for easy when empty
+	Difficulty string `json:"difficulty"`
+	Variant    string `json:"variant"` // classic when empty, killer or samurai
+	Size       int    `json:"size"`    // 9 when 0, or 4 and 6 for classic and killer
+	Count      int    `json:"count"`   // sudokus a volume
+	Nx         int    `json:"nx"`      // grids across a puzzle page, 1 when 0
+	Ny         int    `json:"ny"`      // grids down a puzzle page, 2 when 0
+	TitlePage  *bool  `json:"titlePage"`
+	Solutions  string `json:"solutions"` // grid (2 x 3 a page), compact (3 x 4) or none
+}
+
+// Spec is the book a -book file describes, section by section
+type Spec struct {
+	Sections []Section `json:"sections"`
+}
+
+// Default is the book without a -book file
+var Default = Spec{Sections: []Section{
+	{Difficulty: "simple", Count: 50},
+	{Difficulty: "easy", Count: 50},
+	{Difficulty: "intermediate", Count: 150},
+	{Difficulty: "expert", Count: 300},
+}}
+
+// SolutionLayouts are the solution pages, grids across and down
+var SolutionLayouts = map[string][2]int{
+	"grid":    {2, 3},
+	"compact": {3, 4},
+}
+
+// Read reads a book file, or returns the default book for ""
+func Read(filename string) (Spec, error) {
+	name := "the default book"
+	if filename != "" {
+		name = filename
+	}
+	book := Spec{Sections: append([]Section(nil), Default.Sections...)}
+	if filename != "" {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return book, err
+		}
+		book = Spec{}
+		if err := json.Unmarshal(data, &book); err != nil {
+			return book, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(book.Sections) == 0 {
+			return book, fmt.Errorf("%s: the book has no sections", name)
+		}
+	}
+
+	for i := range book.Sections {
+		s := &book.Sections[i]
+		s.Difficulty = strings.ToLower(s.Difficulty)
+		switch s.Difficulty {
+		case "simple", "easy", "intermediate", "expert":
+		default:
+			return book, fmt.Errorf("%s: section %d: invalid difficulty %q", name, i+1, s.Difficulty)
+		}
+		s.Variant = strings.ToLower(s.Variant)
+		shape, err := sudoku.NewShape(s.Variant, s.Size)
+		if err != nil {
+			return book, fmt.Errorf("%s: section %d: %w", name, i+1, err)
+		}
+		s.Variant, s.Size = shape.Variant, shape.Size
+		if s.Count < 1 {
+			return book, fmt.Errorf("%s: section %d: count must be at least 1", name, i+1)
+		}
+		if s.Nx == 0 {
+			s.Nx = 1
+		}
+		if s.Ny == 0 {
+			s.Ny = 2
+		}
+		if s.Nx < 1 || s.Ny < 1 || s.Nx > 6 || s.Ny > 6 {
+			return book, fmt.Errorf("%s: section %d: nx and ny must be 1 to 6", name, i+1)
+		}
+		if s.Solutions == "" {
+			s.Solutions = "grid"
+		}
+		if _, ok := SolutionLayouts[s.Solutions]; !ok && s.Solutions != "none" {
+			return book, fmt.Errorf("%s: section %d: solutions %q, one of grid, compact, none", name, i+1, s.Solutions)
+		}
+		if s.TitlePage == nil {
+			titlePage := true
+			s.TitlePage = &titlePage
+		}
+	}
+	return book, nil
+}
+
+// Shape is the shape of the section's sudokus
+func (s Section) Shape() sudoku.Shape {
+	return Game{Variant: s.Variant, Size: s.Size}.Shape()
+}
+
+// kind names the sudokus a section takes, its difficulty of its shape
+func (s Section) kind() string {
+	shape := s.Shape()
+	if shape.Classic() {
+		return s.Difficulty
+	}
+	return shape.Name() + " " + s.Difficulty
+}
+
+// Offsets returns where each section starts among the sudokus of its
+// difficulty and shape. Sections of one kind take the sudokus after each
+// other, and a volume starts after all those the volumes before it took of
+// that kind.
+func Offsets(volume int, sections []Section) []int {
+	perVolume := map[string]int{}
+	for _, section := range sections {
+		perVolume[section.kind()] += section.Count
+	}
+	taken := map[string]int{}
+	offsets := make([]int, len(sections))
+	for i, section := range sections {
+		kind := section.kind()
+		offsets[i] = taken[kind]
+		if volume > 1 {
+			offsets[i] += ((volume - 1) * perVolume[kind]) + 1
+		}
+		taken[kind] += section.Count
+	}
+	return offsets
+}
+
+// SheetOffset is where the sudokus of a volume of generatepdf.go start in
+// their table: the first volume at the start, any other after volume*100+1
+// of them
+func SheetOffset(volume int) int {
+	if volume > 1 {
+		return (volume * 100) + 1
+	}
+	return 0
+}
+
+// Fetch reads the volume's sudokus of every section from its offset,
+// failing with ErrNotEnoughPuzzles rather than leaving empty games for the
+// pdf, and puts each section in order. The filter's symmetry and givens
+// only pick the classic 9 x 9 sudokus, the other shapes are generated
+// without them.
+func Fetch(puzzles store.Store, volume int, sections []Section, offsets []int, filter store.Filter, order string, seed int64) ([][]Game, error) {
+	var results = make([][]Game, len(sections))
+	for i, section := range sections {
+		offset := offsets[i]
+		limit := section.Count
+		difficulty := section.Difficulty
+
+		picks := filter
+		picks.Variant, picks.Size = section.Variant, section.Size
+		if !section.Shape().Classic() {
+			picks = store.Filter{Variant: section.Variant, Size: section.Size}
+		}
+		listed, err := puzzles.List(difficulty, picks, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		if len(listed) < limit {
+			return nil, fmt.Errorf("%w: volume %d needs %d %s sudokus after the first %d, sudoku_%s only has %d more that match", ErrNotEnoughPuzzles, volume, limit, section.kind(), offset, difficulty, len(listed))
+		}
+
+		results[i] = make([]Game, limit)
+		for k, p := range listed {
+			results[i][k] = Game{ID: p.ID, Game: p.Game, Solution: p.Solution, Variant: p.Variant, Size: p.Size, Cages: p.Cages, Symmetry: p.Symmetry, Score: p.Score}
+		}
+		Order(results[i], order, seed+int64(i))
+	}
+	return results, nil
+}
+
+// ReadFixture reads sudokus from a file instead of the database, one
+// "game solution [symmetry [cages]]" per line, and keeps those of the
+// shape: a game's length tells its size, and a killer has cages. It takes
+// amount of them from the offset on, going round them as often as it
+// takes, and feeds golden.go fixed puzzles.
+func ReadFixture(filename string, shape sudoku.Shape, amount, offset int) ([]Game, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrStore, err)
+	}
+	var games []Game
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields[0]) != len(fields[1]) {
+			return nil, fmt.Errorf("%w: %s:%d: expected a game and a solution", store.ErrStore, filename, i+1)
+		}
+		if len(fields[0]) != shape.Len() || (len(fields) > 3) != (shape.Variant == "killer") {
+			continue
+		}
+		game := Game{Game: fields[0], Solution: fields[1], Variant: shape.Variant, Size: shape.Size}
+		if len(fields) > 2 {
+			game.Symmetry = sql.NullString{String: fields[2], Valid: true}
+		}
+		if len(fields) > 3 {
+			if _, err := sudoku.ParseCages(fields[3]); err != nil {
+				return nil, fmt.Errorf("%w: %s:%d: %w", store.ErrStore, filename, i+1, err)
+			}
+			game.Cages = fields[3]
+		}
+		games = append(games, game)
+	}
+	if len(games) == 0 {
+		return nil, fmt.Errorf("%w: %s has no %s sudokus", ErrNotEnoughPuzzles, filename, shape.Name())
+	}
+	fixed := make([]Game, amount)
+	for k := range fixed {
+		fixed[k] = games[(offset+k)%len(games)]
+	}
+	return fixed, nil
+}
+
+// Order puts the games of a section in order of their score. The volume
+// still decides which puzzles are in a section, the order only where they
+// go. interleaved deals the easier and the harder half in turns, so the
+// section gets harder with a breather every other puzzle.
+func Order(games []Game, order string, seed int64) {
+	unscored := 0
+	for _, game := range games {
+		if !game.Score.Valid {
+			unscored++
+		}
+	}
+	if unscored > 0 && order != "id" && order != "random" {
+		// without a score they count as the easiest
+		where := map[string]string{"ascending": "go first", "descending": "go last", "interleaved": "count as the easiest"}[order]
+		fmt.Printf("%d sudokus have no score and %s, run generate.go -rescore\n", unscored, where)
+	}
+
+	switch order {
+	case "ascending", "interleaved":
+		sort.SliceStable(games, func(a, b int) bool { return games[a].Score.Int64 < games[b].Score.Int64 })
+	case "descending":
+		sort.SliceStable(games, func(a, b int) bool { return games[a].Score.Int64 > games[b].Score.Int64 })
+	case "random":
+		rand.New(rand.NewSource(seed)).Shuffle(len(games), func(a, b int) { games[a], games[b] = games[b], games[a] })
+	}
+
+	if order == "interleaved" {
+		sorted := append([]Game(nil), games...)
+		half := (len(sorted) + 1) / 2
+		for k := range sorted {
+			if k%2 == 0 {
+				games[k] = sorted[k/2]
+			} else {
+				games[k] = sorted[half+k/2]
+			}
+		}
+	}
+}
+
+// OrderSeed is the seed for random orders, unseeded builds get a new order
+// every time
+func OrderSeed(order string, seed int64) int64 {
+	if order == "random" && seed == 0 {
+		return time.Now().UnixNano()
+	}
+	return seed
+}
+
+// FileName names the pdf of a layout: by the seed for seeded builds, which
+// are made again byte for byte, or by the time it was drawn
+func FileName(seed int64, layout string) string {
+	timestamp := time.Now().Format("20060102-150405")
+	if seed != 0 {
+		timestamp = fmt.Sprintf("seed-%d", seed)
+	}
+	return fmt.Sprintf("sudokus-%v-%s.pdf", timestamp, layout)
+}
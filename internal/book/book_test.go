@@ -0,0 +1,181 @@
+package book
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+func TestRead(t *testing.T) {
+	spec, err := Read(filepath.Join("..", "..", "testdata", "book.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bonus := spec.Sections[2]
+	if spec.Sections[1].Nx != 1 || spec.Sections[0].Solutions != "compact" || spec.Sections[1].Solutions != "grid" || bonus.Ny != 2 || *bonus.TitlePage || !*spec.Sections[0].TitlePage {
+		t.Errorf("the defaults are not filled in: %+v", spec.Sections)
+	}
+
+	spec, err = Read("")
+	if err != nil || !reflect.DeepEqual(spec.Sections[3].Difficulty, "expert") || spec.Sections[3].Count != 300 {
+		t.Errorf("default book %+v, %v", spec, err)
+	}
+	if Default.Sections[0].TitlePage != nil {
+		t.Errorf("Read changed the default book")
+	}
+
+	dir := t.TempDir()
+	for _, c := range []struct {
+		book, err string
+	}{
+		{`{"sections": []}`, "no sections"},
+		{`{"sections": [{"difficulty": "hard", "count": 1}]}`, `invalid difficulty "hard"`},
+		{`{"sections": [{"difficulty": "easy"}]}`, "count must be at least 1"},
+		{`{"sections": [{"difficulty": "easy", "count": 1, "nx": 7}]}`, "nx and ny must be 1 to 6"},
+		{`{"sections": [{"difficulty": "easy", "count": 1, "solutions": "tiny"}]}`, `solutions "tiny"`},
+		{`{"sections": [{"difficulty": "easy", "count": 1}, {"difficulty": "easy", "count": 1, "variant": "jigsaw"}]}`, `section 2: unknown variant "jigsaw"`},
+		{`{"sections": [{"difficulty": "easy", "count": 1, "variant": "samurai", "size": 6}]}`, "made of 9 x 9 grids"},
+	} {
+		filename := filepath.Join(dir, "book.json")
+		if err := os.WriteFile(filename, []byte(c.book), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(filename); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got %v, want an error with %q", c.book, err, c.err)
+		}
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	sections := []Section{{Difficulty: "expert", Count: 3}, {Difficulty: "easy", Count: 4}, {Difficulty: "expert", Count: 2}}
+	for volume, want := range map[int][]int{1: {0, 0, 3}, 2: {6, 5, 9}, 3: {11, 9, 14}} {
+		if got := Offsets(volume, sections); !reflect.DeepEqual(got, want) {
+			t.Errorf("volume %d: offsets %v, want %v", volume, got, want)
+		}
+	}
+	// sudokus of another shape are counted apart
+	sections = append(sections, Section{Difficulty: "expert", Variant: "killer", Count: 4})
+	if got := Offsets(2, sections); !reflect.DeepEqual(got, []int{6, 5, 9, 5}) {
+		t.Errorf("volume 2 with a killer section: offsets %v", got)
+	}
+	if SheetOffset(1) != 0 || SheetOffset(2) != 201 {
+		t.Errorf("sheet offsets %d, %d", SheetOffset(1), SheetOffset(2))
+	}
+}
+
+func TestReadFixture(t *testing.T) {
+	games, err := ReadFixture(filepath.Join("..", "..", "testdata", "fixture.txt"), Game{}.Shape(), 12, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fixture has 8 classic sudokus, so the twelve from the eighth on go round
+	if games[1] != games[9] || games[0] == games[1] || !games[0].Symmetry.Valid {
+		t.Errorf("the fixture does not go round: %+v", games)
+	}
+
+	// the other shapes are told apart by their length and cages
+	for _, c := range []struct {
+		variant string
+		size    int
+		count   int
+	}{{"classic", 6, 3}, {"killer", 9, 2}, {"samurai", 9, 2}} {
+		shape := Game{Variant: c.variant, Size: c.size}.Shape()
+		games, err := ReadFixture(filepath.Join("..", "..", "testdata", "fixture.txt"), shape, c.count+1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if games[0] != games[c.count] || games[0] == games[1] {
+			t.Errorf("%s: expected %d of them: %+v", shape.Name(), c.count, games)
+		}
+		for _, game := range games {
+			cages, _ := sudoku.ParseCages(game.Cages)
+			if solution, err := shape.Solve(game.Game, cages); err != nil || solution != game.Solution {
+				t.Errorf("%s: %s solves as %s, %v", shape.Name(), game.Game, solution, err)
+			}
+			if (game.Cages != "") != (c.variant == "killer") || game.Variant != c.variant || game.Size != c.size {
+				t.Errorf("%s: read %+v", shape.Name(), game)
+			}
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	var games []Game
+	for _, score := range []int64{5, 1, 4, 2, 3} {
+		games = append(games, Game{ID: score, Score: sql.NullInt64{Int64: score, Valid: true}})
+	}
+	ids := func() []int64 {
+		var ids []int64
+		for _, game := range games {
+			ids = append(ids, game.ID)
+		}
+		return ids
+	}
+	for _, c := range []struct {
+		order string
+		want  []int64
+	}{
+		{"ascending", []int64{1, 2, 3, 4, 5}},
+		{"descending", []int64{5, 4, 3, 2, 1}},
+		{"interleaved", []int64{1, 4, 2, 5, 3}},
+	} {
+		Order(games, c.order, 1)
+		if got := ids(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: %v, want %v", c.order, got, c.want)
+		}
+	}
+}
+
+// The auto gutter is chosen by the page count before the pages are drawn,
+// so sheetPages and bookPages have to count what Sheets and Mix draw
+func TestPages(t *testing.T) {
+	fixture := filepath.Join("..", "..", "testdata", "fixture.txt")
+	options := Options{Margin: 6, Font: "Helvetica", Compress: true}
+	for _, c := range []struct {
+		count, nx, ny int
+		orientation   string
+	}{{6, 1, 2, "P"}, {7, 2, 1, "L"}, {13, 3, 3, "P"}} {
+		games, err := ReadFixture(fixture, Game{}.Shape(), c.count, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := Sheets(games, c.nx, c.ny, 1, "easy", c.orientation, "A5", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := bytes.Count(data, []byte("/Type /Page\n")), sheetPages(c.count, c.nx*c.ny); got != want {
+			t.Errorf("%d sudokus %d x %d: Sheets drew %d pages, sheetPages says %d", c.count, c.nx, c.ny, got, want)
+		}
+		if !bytes.HasPrefix(data, []byte("%PDF-")) {
+			t.Errorf("%d sudokus %d x %d: %.20q comes before the header", c.count, c.nx, c.ny, data)
+		}
+	}
+
+	for _, name := range []string{"book.json", "variants.json"} {
+		spec, err := Read(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sudokus [][]Game
+		for i, section := range spec.Sections {
+			games, err := ReadFixture(fixture, section.Shape(), section.Count, Offsets(1, spec.Sections)[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			sudokus = append(sudokus, games)
+		}
+		data, err := Mix(sudokus, spec.Sections, 1, "Letter", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := bytes.Count(data, []byte("/Type /Page\n")), bookPages(sudokus, spec.Sections); got != want {
+			t.Errorf("%s: Mix drew %d pages, bookPages says %d", name, got, want)
+		}
+	}
+}
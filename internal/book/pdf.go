@@ -0,0 +1,753 @@
+package book
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/schokotets/drawsudokus/internal/printpdf"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+// Options of a pdf beyond the number of grids on a page
+type Options struct {
+	Seed         int64
+	ShowSymmetry bool
+	Candidates   int // pencil in candidates of cells with at most this many
+	Margin       float64
+	Font         string
+	Compress     bool
+	Bleed        float64 // mm added around the trimmed page
+	Marks        bool    // crop and registration marks outside the bleed
+	Gutter       float64 // mm added to the inside margin, or printpdf.AutoGutter
+	Tagged       bool    // structure tree, alt text and text attachments
+	Lang         string  // language of a tagged pdf
+}
+
+// header text for each symmetry, "none" and unknown ones get nothing
+var symmetryLabels = map[string]string{
+	"rotate180":  "180° rotational symmetry",
+	"rotate90":   "90° rotational symmetry",
+	"horizontal": "horizontal mirror symmetry",
+	"vertical":   "vertical mirror symmetry",
+	"diagonal":   "diagonal symmetry",
+	"dihedral":   "full symmetry",
+}
+
+// bindingGutter is the extra inside margin of a perfect bound book with
+// that many pages, the thicker the book the more the spine takes in
+func bindingGutter(pages int) float64 {
+	switch {
+	case pages <= 150:
+		return 9.6 // 0.375 in
+	case pages <= 300:
+		return 12.7
+	case pages <= 500:
+		return 15.9
+	case pages <= 700:
+		return 19.1
+	}
+	return 22.3
+}
+
+// seedPDF records the seed and pins everything gofpdf would otherwise take
+// from the clock or from map order
+func seedPDF(pdf *gofpdf.Fpdf, seed int64) {
+	date := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	pdf.SetCreationDate(date)
+	pdf.SetModificationDate(date)
+	pdf.SetCatalogSort(true)
+	pdf.SetKeywords(fmt.Sprintf("seed=%d", seed), false)
+}
+
+// gameCandidates returns the digits still possible in every empty cell of a
+// qqwing one-line game, as bits 1 to 9
+func gameCandidates(game string) [81]uint16 {
+	var cands [81]uint16
+	for i := 0; i < 81; i++ {
+		if game[i] == '.' {
+			used := uint16(0)
+			for j := 0; j < 81; j++ {
+				if game[j] != '.' && (j/9 == i/9 || j%9 == i%9 || (j/27 == i/27 && (j%9)/3 == (i%9)/3)) {
+					used |= 1 << (game[j] - '0')
+				}
+			}
+			cands[i] = ^used & 0x3fe
+		}
+	}
+	return cands
+}
+
+// drawCandidates pencils the candidates of the empty cells that have at most
+// limit of them, each digit in its own third of the cell like a keypad
+func drawCandidates(pdf *gofpdf.Fpdf, font string, game string, x0, y0, fieldL float64, limit int) {
+	cands := gameCandidates(game)
+	pdf.SetFont(font, "", fieldL*0.28*2.83)
+	pdf.SetTextColor(100, 100, 100)
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			c := cands[i*9+j]
+			count := 0
+			for b := c; b != 0; b &= b - 1 {
+				count++
+			}
+			if c == 0 || count > limit {
+				continue
+			}
+			for v := 1; v <= 9; v++ {
+				if c&(1<<v) != 0 {
+					pdf.MoveTo(x0+fieldL*float64(i)+fieldL/3*float64((v-1)%3), y0+fieldL*float64(j)+fieldL/3*float64((v-1)/3))
+					pdf.CellFormat(fieldL/3, fieldL/3, fmt.Sprint(v), "", 0, "CM", false, 0, "")
+				}
+			}
+		}
+	}
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// drawGrid draws a game, or its solution, L across from x0, y0: the lines
+// of every grid, thick between the boxes, a killer's cages around the
+// puzzle and the digits, each into its cell of the table
+func drawGrid(pdf *gofpdf.Fpdf, tags *printpdf.Tags, cells [][]*printpdf.Elem, font string, game Game, solution bool, x0, y0, L float64) {
+	shape := game.Shape()
+	grid := game.Game
+	if solution {
+		grid = game.Solution
+	}
+	fieldL := L / float64(shape.Width)
+	gridL := fieldL * float64(shape.Size)
+	thinLineWidth := gridL / 300
+	thickLineWidth := gridL / 120
+
+	// set font for sudoku
+	pdf.SetFont(font, "", fieldL*0.8*2.83) //2.83 points is a mm
+
+	tags.Artifact()
+	for _, g := range shape.Grids {
+		gx := x0 + fieldL*float64(g[0])
+		gy := y0 + fieldL*float64(g[1])
+		// draw horizontal lines
+		for ly := 0; ly <= shape.Size; ly++ {
+			w := thinLineWidth
+			if ly%shape.BoxH == 0 {
+				w = thickLineWidth
+			}
+			pdf.SetLineWidth(w)
+			pdf.Line(gx-w/2, gy+fieldL*float64(ly), gx+w/2+gridL, gy+fieldL*float64(ly))
+		}
+		// draw vertical lines
+		for lx := 0; lx <= shape.Size; lx++ {
+			w := thinLineWidth
+			if lx%shape.BoxW == 0 {
+				w = thickLineWidth
+			}
+			pdf.SetLineWidth(w)
+			pdf.Line(gx+fieldL*float64(lx), gy-w/2, gx+fieldL*float64(lx), gy+w/2+gridL)
+		}
+	}
+	if cages, _ := sudoku.ParseCages(game.Cages); len(cages) > 0 && !solution {
+		drawCages(pdf, font, shape.Size, cages, x0, y0, fieldL)
+		pdf.SetFont(font, "", fieldL*0.8*2.83)
+	}
+	tags.End()
+
+	// draw numbers
+	board := shape.Board(grid)
+	for i := 0; i < shape.Width; i++ {
+		for j := 0; j < shape.Width; j++ {
+			n := board[j][i]
+			if n != '.' && n != ' ' {
+				dy := fieldL / 20
+				pdf.MoveTo(x0+fieldL*float64(i), y0+fieldL*float64(j)+dy)
+
+				//parameters for drawing the number: cell w, h, number, no borders,
+				//don't move, center verically & horizontally, no fill, no link x2
+				tags.Begin(cells[j][i])
+				pdf.CellFormat(fieldL, fieldL, string(n), "", 0, "CM", false, 0, "")
+				tags.End()
+			}
+		}
+	}
+}
+
+// drawCages draws the cages of a killer of that size as dashed lines just
+// inside their cells, with the sum over the line in the top left cell
+func drawCages(pdf *gofpdf.Fpdf, font string, size int, cages []sudoku.Cage, x0, y0, fieldL float64) {
+	pdf.SetLineWidth(fieldL / 60)
+	pdf.SetDashPattern([]float64{fieldL / 15, fieldL / 15}, 0)
+	for _, side := range CageSides(size, cages, 0.1) {
+		pdf.Line(x0+fieldL*side[0], y0+fieldL*side[1], x0+fieldL*side[2], y0+fieldL*side[3])
+	}
+	pdf.SetDashPattern([]float64{}, 0)
+
+	d := fieldL / 10
+	pdf.SetFont(font, "", fieldL*0.25*2.83)
+	pdf.SetFillColor(255, 255, 255)
+	for _, cage := range cages {
+		col, row := SumCell(size, cage)
+		sum := fmt.Sprint(cage.Sum)
+		pdf.MoveTo(x0+fieldL*float64(col)+d/2, y0+fieldL*float64(row)+d/2)
+		pdf.CellFormat(pdf.GetStringWidth(sum)+d/2, fieldL/4, sum, "", 0, "CM", true, 0, "")
+	}
+}
+
+// CageSides are the lines that outline the cages of a killer of that size,
+// inset into their cells by that share of a cell, as x1, y1, x2, y2 in
+// cells from the top left of the grid. A side runs where the neighbour is
+// in another cage and reaches the edge of the cell where it goes on into
+// the next.
+func CageSides(size int, cages []sudoku.Cage, inset float64) [][4]float64 {
+	in := map[int]int{}
+	for k, cage := range cages {
+		for _, c := range cage.Cells {
+			in[c] = k
+		}
+	}
+	same := func(k, col, row int) bool {
+		if col < 0 || row < 0 || col >= size || row >= size {
+			return false
+		}
+		other, ok := in[col*size+row]
+		return ok && other == k
+	}
+	// where a side ends toward a neighbour: inside the cell when the
+	// neighbour is in another cage, at the edge when the side goes on into
+	// it, and past the edge at an inner corner of the cage
+	end := func(along, diagonal bool) float64 {
+		switch {
+		case !along:
+			return inset
+		case !diagonal:
+			return 0
+		}
+		return -inset
+	}
+
+	var sides [][4]float64
+	for k, cage := range cages {
+		for _, c := range cage.Cells {
+			col, row := c/size, c%size
+			x, y := float64(col), float64(row)
+			if !same(k, col, row-1) {
+				sides = append(sides, [4]float64{x + end(same(k, col-1, row), same(k, col-1, row-1)), y + inset, x + 1 - end(same(k, col+1, row), same(k, col+1, row-1)), y + inset})
+			}
+			if !same(k, col, row+1) {
+				sides = append(sides, [4]float64{x + end(same(k, col-1, row), same(k, col-1, row+1)), y + 1 - inset, x + 1 - end(same(k, col+1, row), same(k, col+1, row+1)), y + 1 - inset})
+			}
+			if !same(k, col-1, row) {
+				sides = append(sides, [4]float64{x + inset, y + end(same(k, col, row-1), same(k, col-1, row-1)), x + inset, y + 1 - end(same(k, col, row+1), same(k, col-1, row+1))})
+			}
+			if !same(k, col+1, row) {
+				sides = append(sides, [4]float64{x + 1 - inset, y + end(same(k, col, row-1), same(k, col+1, row-1)), x + 1 - inset, y + 1 - end(same(k, col, row+1), same(k, col+1, row+1))})
+			}
+		}
+	}
+	return sides
+}
+
+// SumCell is the cell a cage's sum is written in, its top left one, as the
+// column and row of a killer of that size
+func SumCell(size int, cage sudoku.Cage) (int, int) {
+	first := cage.Cells[0]
+	for _, c := range cage.Cells {
+		if c%size < first%size || c%size == first%size && c < first {
+			first = c
+		}
+	}
+	return first / size, first % size
+}
+
+// gridAlt describes a game, or its solution, to a screen reader, with a
+// killer's cages after the puzzle
+func gridAlt(title string, game Game, solution bool) string {
+	shape := game.Shape()
+	what := fmt.Sprintf("a %d by %d grid", shape.Size, shape.Size)
+	switch shape.Variant {
+	case "killer":
+		what = fmt.Sprintf("a %d by %d killer sudoku grid", shape.Size, shape.Size)
+	case "samurai":
+		what = fmt.Sprintf("a samurai sudoku of five overlapping 9 by 9 grids, %d by %d cells", shape.Width, shape.Width)
+	}
+	if solution {
+		return printpdf.GridAlt(title, shape.Board(game.Solution), what)
+	}
+	alt := printpdf.GridAlt(title, shape.Board(game.Game), what)
+	if cages := game.CageText(); cages != "" {
+		alt += " " + cages
+	}
+	return alt
+}
+
+// attachment is the text file of a game, the puzzle with a killer's cages
+// and its solution
+func attachment(title string, game Game) []byte {
+	shape := game.Shape()
+	text := title + "\n\n" + printpdf.GridText(shape.Board(game.Game), shape.BoxW, shape.BoxH)
+	if cages := game.CageText(); cages != "" {
+		text += "\n" + cages + "\n"
+	}
+	return []byte(text + "\nSolution\n\n" + printpdf.GridText(shape.Board(game.Solution), shape.BoxW, shape.BoxH))
+}
+
+func smaller(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// sheetPages is the number of pages Sheets draws for count sudokus,
+// perPage to a puzzle page: a title page before the puzzles and one before
+// the solutions, six to a page
+func sheetPages(count int, perPage int) int {
+	return 1 + (count+perPage-1)/perPage + 1 + (count+5)/6
+}
+
+// Sheets draws the layout of generatepdf.go: a title page, the sudokus nx
+// by ny to a page and their solutions six to a page
+func Sheets(sudokus []Game, nx, ny int, volume int, difficulty string, orientation string, paperSize string, options Options) ([]byte, error) {
+	count := len(sudokus)
+	sudokuIndex := 0
+
+	difficulty = strings.Title(difficulty)
+
+	// title := strings.Title(fmt.Sprintf(difficulty+" Sudoku - Volume #%d - ZebiGames", volume))
+
+	if options.Gutter == printpdf.AutoGutter {
+		options.Gutter = bindingGutter(sheetPages(count, nx*ny))
+	}
+	pdf, width, height := printpdf.New(orientation, paperSize, printpdf.Options{Bleed: options.Bleed, Marks: options.Marks, Gutter: options.Gutter, Tagged: options.Tagged})
+	if options.Seed != 0 {
+		seedPDF(pdf, options.Seed)
+	}
+	pdf.SetCompression(options.Compress)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	var tags *printpdf.Tags
+	if options.Tagged {
+		tags = printpdf.NewTags(pdf)
+		pdf.SetTitle(fmt.Sprintf("%s Sudoku Puzzles - Volume %d", difficulty, volume), false)
+		attachments := make([]gofpdf.Attachment, count)
+		for i := range attachments {
+			title := fmt.Sprintf("Sudoku - %s #%d", difficulty, i+1)
+			attachments[i] = gofpdf.Attachment{
+				Content:     attachment(title, sudokus[i]),
+				Filename:    fmt.Sprintf("sudoku-%s-%d.txt", strings.ToLower(difficulty), i+1),
+				Description: title,
+			}
+		}
+		pdf.SetAttachments(attachments)
+	}
+	//  pages for prelim
+	// pdf.AddPage()
+	margin := options.Margin
+
+	drawingWidth := width - 5*margin
+	drawingHeight := height - 6*margin
+
+	offsetY := (height - drawingHeight) / 2
+
+	L := smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
+	fieldL := L / 9
+
+	//draw title
+	if tags == nil {
+		// there is no page yet, so only move: a MoveTo would draw its
+		// operator before the header of the file
+		pdf.SetXY(0, 0)
+	}
+	pdf.SetFont(options.Font, "B", 24)
+	if tags != nil {
+		// the heading is marked on the page it is drawn on, so the page is
+		// started here rather than by the page break of CellFormat, with
+		// the title 1 cm down where the break puts it
+		pdf.AddPage()
+		pdf.SetAutoPageBreak(false, 0)
+		pdf.SetXY(0, 10)
+	}
+	part := tags.Elem(nil, "Part", "")
+	heading := tags.Elem(part, "H1", "")
+	tags.Begin(heading)
+	pdf.CellFormat(width, height, fmt.Sprint(difficulty, " Puzzles"), "", 1, "MC", false, 0, "")
+	tags.End()
+
+	np := count / (nx * ny)
+	if (count % (nx * ny)) != 0 {
+		np += 1
+	}
+
+	for W := 0; W < np; W++ {
+
+		pdf.AddPage()
+		pdf.SetMargins(0, 0, 0)
+		pdf.SetAutoPageBreak(false, 0)
+		pdf.SetDrawColor(0, 0, 0)
+
+		for X := 0; X < nx; X++ {
+			for Y := 0; Y < ny; Y++ {
+
+				if sudokuIndex >= count {
+					break
+				}
+				x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
+				y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
+
+				// write game number on top
+				section := tags.Elem(part, "Sect", "")
+				heading := tags.Elem(section, "H2", "")
+				pdf.SetFont(options.Font, "B", fieldL*0.7*2.83)
+				pdf.MoveTo(x0, y0-2*margin)
+				tags.Begin(heading)
+				if label := symmetryLabels[sudokus[sudokuIndex].Symmetry.String]; options.ShowSymmetry && label != "" {
+					// the symmetry goes on a line of its own in the header
+					pdf.CellFormat(L, 1.3*margin, fmt.Sprintf("Sudoku - %s #%d ", difficulty, sudokuIndex+1), "", 0, "MC", false, 0, "")
+					pdf.SetFont(options.Font, "I", fieldL*0.35*2.83)
+					pdf.MoveTo(x0, y0-0.7*margin)
+					pdf.CellFormat(L, 0.7*margin, tr(label), "", 0, "MC", false, 0, "")
+				} else {
+					pdf.CellFormat(L, 2*margin, fmt.Sprintf("Sudoku - %s #%d ", difficulty, sudokuIndex+1), "", 0, "MC", false, 0, "")
+				}
+				tags.End()
+				game := sudokus[sudokuIndex]
+				cells := tags.GridTable(section, gridAlt(fmt.Sprintf("Sudoku - %s #%d", difficulty, sudokuIndex+1), game, false), game.Shape().Width)
+
+				drawGrid(pdf, tags, cells, options.Font, game, false, x0, y0, L)
+				if options.Candidates > 0 && game.Shape().Classic() {
+					tags.Artifact()
+					drawCandidates(pdf, options.Font, game.Game, x0, y0, fieldL, options.Candidates)
+					tags.End()
+				}
+				sudokuIndex++
+			}
+		}
+
+	}
+
+	// populate answer pages
+	np = count / 6
+	if (count % 6) != 0 {
+		np += 1
+	}
+
+	nx = 2
+	ny = 2
+
+	if orientation == "L" {
+		nx = 3
+	}
+	if orientation == "P" {
+		ny = 3
+	}
+
+	sudokuIndex = 0
+
+	drawingWidth = width - 6*margin   // 2 for the heading + 1 left + 1 right
+	drawingHeight = height - 5*margin // 3 top, 1 bottom
+
+	offsetY = (height - drawingHeight) / 2.5
+
+	L = smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
+	fieldL = L / 9
+
+	// solutions title
+	pdf.AddPage()
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetDrawColor(0, 0, 0)
+
+	//draw title
+	pdf.MoveTo(0, 0)
+	pdf.SetFont(options.Font, "B", 24)
+	part = tags.Elem(nil, "Part", "")
+	tags.Begin(tags.Elem(part, "H1", ""))
+	pdf.CellFormat(width, height, fmt.Sprint(difficulty, " Solutions"), "", 1, "MC", false, 0, "")
+	tags.End()
+
+	// main solutions
+	for W := 0; W < np; W++ {
+
+		pdf.AddPage()
+		pdf.SetMargins(0, 0, 0)
+		pdf.SetAutoPageBreak(false, 0)
+		pdf.SetDrawColor(0, 0, 0)
+
+		for X := 0; X < nx; X++ {
+			for Y := 0; Y < ny; Y++ {
+
+				if sudokuIndex >= count {
+					break
+				}
+				x0 := 4*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
+				y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
+
+				// write game number on top
+				section := tags.Elem(part, "Sect", "")
+				pdf.SetFont(options.Font, "B", fieldL*0.7*2.83)
+				pdf.MoveTo(x0, y0-1*margin)
+				tags.Begin(tags.Elem(section, "H2", ""))
+				pdf.CellFormat(L, 1*margin, fmt.Sprintf("Sudoku - %s #%d", strings.Title(difficulty), sudokuIndex+1), "", 0, "MC", false, 0, "")
+				tags.End()
+				game := sudokus[sudokuIndex]
+				cells := tags.GridTable(section, gridAlt(fmt.Sprintf("Solution of Sudoku - %s #%d", difficulty, sudokuIndex+1), game, true), game.Shape().Width)
+
+				drawGrid(pdf, tags, cells, options.Font, game, true, x0, y0, L)
+				sudokuIndex++
+			}
+		}
+
+	}
+
+	return output(pdf, tags, options.Lang)
+}
+
+// bookPages is the number of pages Mix draws for the sections
+func bookPages(sudokus [][]Game, sections []Section) int {
+	pages := 4
+	for K, section := range sections {
+		count := len(sudokus[K])
+		titlePages := 0
+		if *section.TitlePage {
+			titlePages = 1
+		}
+		pages += titlePages + (count+section.Nx*section.Ny-1)/(section.Nx*section.Ny)
+		if layout, ok := SolutionLayouts[section.Solutions]; ok {
+			pages += titlePages + (count+layout[0]*layout[1]-1)/(layout[0]*layout[1])
+		}
+	}
+	return pages
+}
+
+// Mix draws the layout of mix.go: four pages for the front matter, then
+// every section's sudokus and solutions, each after a title page
+func Mix(sudokus [][]Game, sections []Section, volume int, paperSize string, options Options) ([]byte, error) {
+	// an untitled section is named after its difficulty
+	sections = append([]Section(nil), sections...)
+	for i := range sections {
+		if sections[i].Title == "" {
+			sections[i].Title = strings.Title(sections[i].Difficulty) + " Sudoku"
+		}
+	}
+
+	if options.Gutter == printpdf.AutoGutter {
+		options.Gutter = bindingGutter(bookPages(sudokus, sections))
+	}
+	pdf, width, height := printpdf.New("P", paperSize, printpdf.Options{Bleed: options.Bleed, Marks: options.Marks, Gutter: options.Gutter, Tagged: options.Tagged})
+	if options.Seed != 0 {
+		seedPDF(pdf, options.Seed)
+	}
+	pdf.SetCompression(options.Compress)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	var tags *printpdf.Tags
+	if options.Tagged {
+		tags = printpdf.NewTags(pdf)
+		pdf.SetTitle(fmt.Sprintf("Sudoku Puzzles - Volume %d", volume), false)
+		var attachments []gofpdf.Attachment
+		for K, section := range sections {
+			for i, game := range sudokus[K] {
+				title := fmt.Sprintf("%s - #%d", section.Title, i+1)
+				attachments = append(attachments, gofpdf.Attachment{
+					Content:     attachment(title, game),
+					Filename:    fmt.Sprintf("sudoku-%d-%d.txt", K+1, i+1),
+					Description: title,
+				})
+			}
+		}
+		pdf.SetAttachments(attachments)
+	}
+	// prelim pages
+	pdf.AddPage()
+	pdf.AddPage()
+	pdf.AddPage()
+	pdf.AddPage()
+
+	// continue
+	margin := options.Margin
+	sudokuIndex := 0
+
+	// let's get this looping
+	for K, section := range sections {
+
+		title := section.Title
+		count := len(sudokus[K])
+
+		nx := section.Nx
+		ny := section.Ny
+
+		sudokuIndex = 0
+
+		drawingWidth := width - 6*margin
+		drawingHeight := height - 6*margin
+
+		offsetY := (height - drawingHeight) / 2.5
+
+		L := smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
+		fieldL := L / 9
+
+		part := tags.Elem(nil, "Part", "")
+		if *section.TitlePage {
+			pdf.AddPage()
+			pdf.SetMargins(0, 0, 0)
+			pdf.SetAutoPageBreak(false, 0)
+			pdf.SetDrawColor(0, 0, 0)
+
+			//draw title
+			pdf.MoveTo(0, 0)
+			pdf.SetFont(options.Font, "B", 24)
+			tags.Begin(tags.Elem(part, "H1", ""))
+			pdf.CellFormat(width, height, tr(fmt.Sprint(title, " - Puzzles")), "", 1, "MC", false, 0, "")
+			tags.End()
+			tags.Begin(tags.Elem(part, "P", ""))
+			pdf.CellFormat(width, height, fmt.Sprint("Volume #", volume), "", 1, "MC", false, 0, "")
+			tags.End()
+		}
+
+		np := count / (nx * ny)
+		if (count % (nx * ny)) != 0 {
+			np += 1
+		}
+
+		for W := 0; W < np; W++ {
+
+			pdf.AddPage()
+			pdf.SetMargins(0, 0, 0)
+			pdf.SetAutoPageBreak(false, 0)
+			pdf.SetDrawColor(0, 0, 0)
+
+			for X := 0; X < nx; X++ {
+				for Y := 0; Y < ny; Y++ {
+
+					if sudokuIndex >= count {
+						break
+					}
+					x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
+					y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
+
+					// write game number on top
+					sect := tags.Elem(part, "Sect", "")
+					pdf.SetFont(options.Font, "B", fieldL*0.7*2.83)
+					pdf.MoveTo(x0, y0-2*margin)
+					tags.Begin(tags.Elem(sect, "H2", ""))
+					if label := symmetryLabels[sudokus[K][sudokuIndex].Symmetry.String]; options.ShowSymmetry && label != "" {
+						// the symmetry goes on a line of its own in the header
+						pdf.CellFormat(L, 1.3*margin, tr(fmt.Sprintf("%s - #%d ", title, sudokuIndex+1)), "", 0, "MC", false, 0, "")
+						pdf.SetFont(options.Font, "I", fieldL*0.35*2.83)
+						pdf.MoveTo(x0, y0-0.7*margin)
+						pdf.CellFormat(L, 0.7*margin, tr(label), "", 0, "MC", false, 0, "")
+					} else {
+						pdf.CellFormat(L, 2*margin, tr(fmt.Sprintf("%s - #%d ", title, sudokuIndex+1)), "", 0, "MC", false, 0, "")
+					}
+					tags.End()
+					game := sudokus[K][sudokuIndex]
+					cells := tags.GridTable(sect, gridAlt(fmt.Sprintf("%s - #%d", title, sudokuIndex+1), game, false), game.Shape().Width)
+
+					drawGrid(pdf, tags, cells, options.Font, game, false, x0, y0, L)
+					if options.Candidates > 0 && game.Shape().Classic() {
+						tags.Artifact()
+						drawCandidates(pdf, options.Font, game.Game, x0, y0, fieldL, options.Candidates)
+						tags.End()
+					}
+					sudokuIndex++
+				}
+				pdf.MoveTo(0, height-(3.5*margin))
+				pdf.SetFont(options.Font, "", 14)
+				tags.Artifact()
+				pdf.CellFormat(width, 2*margin, fmt.Sprintf("%d", pdf.PageNo()), "0", 0, "MC", false, 0, "")
+				tags.End()
+			}
+
+		}
+
+		// populate answer pages
+		layout, ok := SolutionLayouts[section.Solutions]
+		if !ok {
+			continue
+		}
+		nx = layout[0]
+		ny = layout[1]
+
+		np = count / (nx * ny)
+		if (count % (nx * ny)) != 0 {
+			np += 1
+		}
+
+		sudokuIndex = 0
+
+		drawingWidth = width - 6*margin
+		drawingHeight = height - 6*margin
+
+		offsetY = (height - drawingHeight) / 2.5
+
+		L = smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
+		fieldL = L / 9
+
+		// solutions title
+		part = tags.Elem(nil, "Part", "")
+		if *section.TitlePage {
+			pdf.AddPage()
+			pdf.SetMargins(0, 0, 0)
+			pdf.SetAutoPageBreak(false, 0)
+			pdf.SetDrawColor(0, 0, 0)
+
+			//draw title
+			pdf.MoveTo(0, 0)
+			pdf.SetFont(options.Font, "B", 24)
+			tags.Begin(tags.Elem(part, "H1", ""))
+			pdf.CellFormat(width, height, tr(fmt.Sprint(title, " - Solutions")), "", 1, "MC", false, 0, "")
+			tags.End()
+		}
+
+		// main solutions
+		for W := 0; W < np; W++ {
+
+			pdf.AddPage()
+			pdf.SetMargins(0, 0, 0)
+			pdf.SetAutoPageBreak(false, 0)
+			pdf.SetDrawColor(0, 0, 0)
+
+			for X := 0; X < nx; X++ {
+				for Y := 0; Y < ny; Y++ {
+
+					if sudokuIndex >= count {
+						break
+					}
+					x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
+					y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
+
+					// write game number on top
+					sect := tags.Elem(part, "Sect", "")
+					pdf.SetFont(options.Font, "B", fieldL*0.7*2.83)
+					pdf.MoveTo(x0, y0-1*margin)
+					tags.Begin(tags.Elem(sect, "H2", ""))
+					pdf.CellFormat(L, 1*margin, tr(fmt.Sprintf("%s - #%d", title, sudokuIndex+1)), "", 0, "MC", false, 0, "")
+					tags.End()
+					game := sudokus[K][sudokuIndex]
+					cells := tags.GridTable(sect, gridAlt(fmt.Sprintf("Solution of %s - #%d", title, sudokuIndex+1), game, true), game.Shape().Width)
+
+					drawGrid(pdf, tags, cells, options.Font, game, true, x0, y0, L)
+					sudokuIndex++
+				}
+				// Page number
+				pdf.MoveTo(0, height-(3.5*margin))
+				pdf.SetFont(options.Font, "", 14)
+				tags.Artifact()
+				pdf.CellFormat(width, 2*margin, fmt.Sprintf("%d", pdf.PageNo()), "0", 0, "MC", false, 0, "")
+				tags.End()
+			}
+
+		}
+	}
+
+	return output(pdf, tags, options.Lang)
+}
+
+// output writes the pdf, with its structure tree when it is tagged
+func output(pdf *gofpdf.Fpdf, tags *printpdf.Tags, lang string) ([]byte, error) {
+	data, err := printpdf.Output(pdf)
+	if err == nil && tags != nil {
+		data, err = tags.Write(data, lang)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	return data, nil
+}
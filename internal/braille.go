@@ -0,0 +1,388 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schokotets/drawsudokus/internal/book"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the tables hold fewer sudokus than the volume needs
+	ErrNotEnoughPuzzles = book.ErrNotEnoughPuzzles
+	// the braille file can't be written
+	ErrRender = errors.New("writing the braille file")
+)
+
+// exitCode tells the kinds of failure apart, like the pdf programs
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotEnoughPuzzles):
+		return 4
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+// a braille page, in cells a line and lines
+type brfPage struct {
+	cells int
+	lines int
+}
+
+// a run of lines that stays on one page, with the title and number of the
+// puzzle for the page header
+type brfBlock struct {
+	section string
+	number  int
+	lines   []string
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to read from, as user:password@tcp(host:port)/dbname")
+	output := flag.String("output", settings["output.dir"], "directory to write the braille file to")
+	fixture := flag.String("fixture", "", "read the sudokus from this file instead of the database")
+	cells := flag.Int("cells", 40, "braille cells a line")
+	lines := flag.Int("lines", 25, "lines a braille page")
+	bookFile := flag.String("book", "", "json file with the sections of the book, as for mix.go; the four levels when empty")
+	seed := flag.Int64("seed", 0, "seed of a random order. seeded builds get a fixed file name so they can be rebuilt byte for byte")
+	symmetry := "any"
+	flag.Var(&config.SymmetryValue{Symmetry: &symmetry}, "symmetry", "only use sudokus with this symmetry, one of any, none, rotate180, rotate90, horizontal, vertical, diagonal, dihedral")
+	minGivens := flag.Int("mingivens", 0, "only use sudokus with at least this many givens")
+	maxGivens := flag.Int("maxgivens", 0, "only use sudokus with at most this many givens, 0 for no limit")
+	order := "id"
+	flag.Var(&config.OrderValue{Order: &order}, "order", "order of the sudokus in a section, one of id, ascending, descending, random (by -seed), interleaved")
+	flag.Parse()
+
+	v := *volume
+	spec, err := book.Read(*bookFile)
+	if err != nil {
+		fail(err)
+	}
+	for i := range spec.Sections {
+		section := &spec.Sections[i]
+		// the pdf's "Easy Sudoku" would only repeat itself in every header
+		if section.Title == "" {
+			section.Title = strings.Title(section.Difficulty)
+		}
+		if r, ok := brailleWritable(section.Title); !ok {
+			fmt.Printf("Error: section %d: braille ascii has no %q for the title %q\n", i+1, r, section.Title)
+			os.Exit(2)
+		}
+	}
+
+	page := brfPage{cells: *cells, lines: *lines}
+	// the widest grid of the book, with its heading and the page header
+	width, height := 0, 0
+	for _, section := range spec.Sections {
+		w, h := gridCells(section.Shape())
+		width, height = max(width, w), max(height, h+3)
+	}
+	if page.cells < width || page.lines < height {
+		fmt.Printf("Error: a braille page needs at least %d cells and %d lines for a grid\n", width, height)
+		os.Exit(2)
+	}
+
+	var sudokus [][]book.Game
+	offsets := book.Offsets(v, spec.Sections)
+	if *fixture != "" {
+		sudokus = make([][]book.Game, len(spec.Sections))
+		for i, section := range spec.Sections {
+			sudokus[i], err = book.ReadFixture(*fixture, section.Shape(), section.Count, offsets[i])
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		var puzzles store.Store
+		if puzzles, err = store.Open(*dsn); err == nil {
+			defer puzzles.Close()
+			sudokus, err = book.Fetch(puzzles, v, spec.Sections, offsets, store.Filter{Symmetry: symmetry, MinGivens: *minGivens, MaxGivens: *maxGivens}, order, book.OrderSeed(order, *seed))
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	timestamp := time.Now().Format("20060102-150405")
+	if *seed != 0 {
+		timestamp = fmt.Sprintf("seed-%d", *seed)
+	}
+	name := "mix"
+	if *bookFile != "" {
+		name = strings.TrimSuffix(filepath.Base(*bookFile), filepath.Ext(*bookFile))
+	}
+	filename := filepath.Join(*output, fmt.Sprintf("sudokus-%v-%s-vol-%d.brf", timestamp, name, v))
+
+	var blocks []brfBlock
+	for K, section := range spec.Sections {
+		title := section.Title
+		for i, game := range sudokus[K] {
+			blocks = append(blocks, brailleGame(brfBlock{title, i + 1, nil}, fmt.Sprintf("%s %d", title, i+1), game, false, page)...)
+		}
+		if section.Solutions == "none" {
+			continue
+		}
+		for i, game := range sudokus[K] {
+			blocks = append(blocks, brailleGame(brfBlock{title + " solution", i + 1, nil}, fmt.Sprintf("%s solution %d", title, i+1), game, true, page)...)
+		}
+	}
+	// a long heading takes more lines, the grid has to stay on its page
+	for _, block := range blocks {
+		if need := 2 + len(block.lines) - 1; need > page.lines {
+			fmt.Printf("Error: %s %d takes %d lines with its heading and the page header, a page has %d\n", block.section, block.number, need, page.lines)
+			os.Exit(2)
+		}
+	}
+
+	data := brfPages(blocks, page)
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		fail(fmt.Errorf("%w: %w", ErrRender, err))
+	}
+	fmt.Printf("Wrote sudokus to file %s\n", filename)
+}
+
+// braille ascii of the grid cells. Digits are the lower cell digits of
+// Nemeth code, which need no number sign, so every cell is one braille cell
+// and they stay apart from the separators in the upper dots.
+const (
+	brfEmpty  = '-' // dots 3 6
+	brfColumn = 'l' // dots 1 2 3, a line down between boxes
+	brfRow    = 'c' // dots 1 4, a line across between bands
+)
+
+// the grids of a samurai sudoku in the order of its game string, see
+// sudoku.Shape
+var samuraiGrids = []string{"top left grid", "top right grid", "middle grid, its corner boxes are those of the other grids", "bottom left grid", "bottom right grid"}
+
+// gridCells is how many cells across and lines down brailleGrid lays a grid
+// of the shape out, a samurai's grids one at a time
+func gridCells(shape sudoku.Shape) (int, int) {
+	n := shape.Size
+	return 2*n - 1 + 2*(n/shape.BoxW-1), n + n/shape.BoxH - 1
+}
+
+// brailleGame lays out a game, or its solution, as the blocks of the
+// section and number: the grid of a classic or killer sudoku and a killer's
+// cages after the puzzle, on as many pages as they take, or the five grids
+// of a samurai one after the other
+func brailleGame(block brfBlock, heading string, game book.Game, solution bool, page brfPage) []brfBlock {
+	shape := game.Shape()
+	grid := game.Game
+	if solution {
+		grid = game.Solution
+	}
+	var blocks []brfBlock
+	if shape.Variant == "samurai" {
+		nine, _ := sudoku.NewShape("classic", 9)
+		for k, label := range samuraiGrids {
+			block.lines = brailleGrid(heading+", "+label, nine.Board(grid[k*81:(k+1)*81]), 3, 3, page.cells)
+			blocks = append(blocks, block)
+		}
+		return blocks
+	}
+
+	block.lines = brailleGrid(heading, shape.Board(grid), shape.BoxW, shape.BoxH, page.cells)
+	blocks = append(blocks, block)
+	if cages := game.CageText(); cages != "" && !solution {
+		lines := brailleWrap(brailleText(cages), page.cells)
+		for len(lines) > 0 {
+			n := min(len(lines), page.lines-2)
+			block.lines = append(lines[:n:n], "")
+			blocks = append(blocks, block)
+			lines = lines[n:]
+		}
+	}
+	return blocks
+}
+
+// brailleGrid lays a board out row by row as it is printed, a space between
+// cells and the boxes of boxW by boxH cells set apart, with its heading
+// wrapped to cells a line and a blank line after it
+func brailleGrid(title string, board []string, boxW, boxH int, cells int) []string {
+	lines := brailleWrap(brailleText(title), cells)
+	for row, line := range board {
+		var b strings.Builder
+		for col := 0; col < len(line); col++ {
+			if col > 0 {
+				b.WriteByte(' ')
+			}
+			if col > 0 && col%boxW == 0 {
+				b.WriteRune(brfColumn)
+				b.WriteByte(' ')
+			}
+			if n := line[col]; n != '.' {
+				b.WriteByte(n)
+			} else {
+				b.WriteRune(brfEmpty)
+			}
+		}
+		if row > 0 && row%boxH == 0 {
+			lines = append(lines, strings.Repeat(string(brfRow), b.Len()))
+		}
+		lines = append(lines, b.String())
+	}
+	return append(lines, "")
+}
+
+// brailleLetters are the letters braille ascii has no cell for, written the
+// way a reader says them
+var brailleLetters = map[rune]rune{
+	'×': 'x', // 6×6
+	'–': '-',
+	'—': '-',
+	'‘': '\'',
+	'’': '\'',
+}
+
+// brailleWritable tells whether brailleText can write all of s, and if not
+// the first letter it can't
+func brailleWritable(s string) (rune, bool) {
+	for _, r := range s {
+		if _, ok := brailleLetters[r]; r >= 0x80 && !ok {
+			return r, false
+		}
+	}
+	return 0, true
+}
+
+// brailleText writes plain text as uncontracted braille ascii: a capital
+// sign before capitals, a number sign before digits, which become the
+// letters a to j, and a letter sign after them before a to j. The letters
+// of brailleLetters are written as theirs, others outside ascii are left
+// out, see brailleWritable.
+func brailleText(s string) string {
+	var b strings.Builder
+	number := false
+	for _, r := range s {
+		if letter, ok := brailleLetters[r]; ok {
+			r = letter
+		}
+		switch {
+		case r >= '0' && r <= '9':
+			if !number {
+				b.WriteByte('#')
+				number = true
+			}
+			b.WriteByte("jabcdefghi"[r-'0'])
+			continue
+		case r >= 'A' && r <= 'Z':
+			b.WriteByte(',')
+			r += 'a' - 'A'
+		case r >= 'a' && r <= 'j' && number:
+			b.WriteByte(';')
+		}
+		number = false
+		switch r {
+		case '.':
+			b.WriteByte('4')
+		case ',':
+			b.WriteByte('1')
+		case ':':
+			b.WriteByte('3')
+		default:
+			if r < 0x80 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// brailleWrap breaks braille ascii into lines of at most cells, between
+// words where it can
+func brailleWrap(text string, cells int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len(word) > cells {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, word[:cells])
+			word = word[cells:]
+		}
+		switch {
+		case line == "":
+			line = word
+		case len(line)+1+len(word) <= cells:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	return append(lines, line)
+}
+
+// brfPages breaks the blocks into braille pages. Every page starts with a
+// header naming the puzzles on it, with the page number at the right, and a
+// blank line; pages end with a form feed and lines with CR LF, as embossers
+// and braille displays expect of a brf file.
+func brfPages(blocks []brfBlock, page brfPage) string {
+	var out strings.Builder
+	number := 0
+	for start := 0; start < len(blocks); {
+		// as many whole blocks as fit under the header
+		end, used := start, 2
+		for end < len(blocks) && used+len(blocks[end].lines) <= page.lines {
+			used += len(blocks[end].lines)
+			end++
+		}
+		if end == start {
+			end++
+		}
+		number++
+
+		first, last := blocks[start], blocks[end-1]
+		header := fmt.Sprintf("%s %d", first.section, first.number)
+		if last.section != first.section || last.number != first.number {
+			if last.section == first.section {
+				header += fmt.Sprintf(" to %d", last.number)
+			} else {
+				header += fmt.Sprintf(" to %s %d", last.section, last.number)
+			}
+		}
+		header = brailleText(header)
+		pageNumber := brailleText(fmt.Sprint(number))
+		// a running header keeps to its line, the words that fit of it
+		header = brailleWrap(header, page.cells-len(pageNumber)-2)[0]
+
+		lines := []string{header + strings.Repeat(" ", page.cells-len(header)-len(pageNumber)) + pageNumber, ""}
+		for _, block := range blocks[start:end] {
+			lines = append(lines, block.lines...)
+		}
+		for len(lines) > 0 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		out.WriteString(strings.Join(lines, "\r\n"))
+		out.WriteString("\r\n\f")
+		start = end
+	}
+	return out.String()
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/schokotets/drawsudokus/internal/config"
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.Arg(0) != "show" {
+		fmt.Println("usage: config show")
+		os.Exit(2)
+	}
+
+	settings, sources, err := config.Load()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// the effective configuration, written so it can be saved as a
+	// drawsudoku.toml
+	sections := []string{"store", "output", "theme", "fonts", "generator"}
+	for n, section := range sections {
+		var keys []string
+		for key := range settings {
+			if strings.HasPrefix(key, section+".") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		if n > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("[%s]\n", section)
+		for _, key := range keys {
+			value := settings[key]
+			if key == "store.dsn" {
+				value = hidePassword(value)
+			}
+			fmt.Printf("%s = %s # %s\n", strings.TrimPrefix(key, section+"."), strconv.Quote(value), sources[key])
+		}
+	}
+}
+
+// hidePassword masks the password of a user:password@... dsn
+func hidePassword(dsn string) string {
+	at := strings.LastIndex(dsn, "@")
+	colon := strings.Index(dsn, ":")
+	if at < 0 || colon < 0 || colon > at {
+		return dsn
+	}
+	return dsn[:colon+1] + "****" + dsn[at:]
+}
@@ -0,0 +1,106 @@
+// Package config reads the settings the programs share from drawsudoku.toml
+// and DRAWSUDOKU_* variables, and has the flag values they parse the same
+// way.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Defaults are the settings drawsudoku.toml and DRAWSUDOKU_* variables can
+// change, with their defaults. theme.papersize and theme.orientation are
+// left to each program when empty, as the layouts were made for different
+// pages.
+var Defaults = map[string]string{
+	"store.dsn":         "root:root@tcp(127.0.0.1:3306)/sudoku",
+	"output.dir":        "sudokus",
+	"theme.papersize":   "",
+	"theme.orientation": "",
+	"theme.margin":      "6",
+	"theme.background":  "4.jpg",
+	"fonts.family":      "Helvetica",
+	"generator.name":    "qqwing",
+	"generator.workers": "0",
+	"generator.batch":   "10",
+}
+
+// Env names the environment variable of a setting, DRAWSUDOKU_STORE_DSN for
+// store.dsn
+func Env(key string) string {
+	return "DRAWSUDOKU_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Load reads the settings from the defaults, the config file and the
+// environment, later ones winning, and tells where each value came from.
+// Flags take their defaults from it, so the command line wins over all.
+// The file is drawsudoku.toml in the working directory, or DRAWSUDOKU_CONFIG.
+func Load() (map[string]string, map[string]string, error) {
+	settings := map[string]string{}
+	sources := map[string]string{}
+	for key, value := range Defaults {
+		settings[key] = value
+		sources[key] = "default"
+	}
+
+	// only a missing default file is fine
+	filename, named := os.LookupEnv("DRAWSUDOKU_CONFIG")
+	if !named {
+		filename = "drawsudoku.toml"
+	}
+	data, err := os.ReadFile(filename)
+	switch {
+	case err == nil:
+		if err := parse(filename, string(data), settings, sources); err != nil {
+			return nil, nil, err
+		}
+	case named || !os.IsNotExist(err):
+		return nil, nil, err
+	}
+
+	for key := range Defaults {
+		if value, ok := os.LookupEnv(Env(key)); ok {
+			settings[key] = value
+			sources[key] = Env(key)
+		}
+	}
+	return settings, sources, nil
+}
+
+// parse reads the part of TOML the settings need: [sections] and
+// key = value lines with quoted or bare values and # comments
+func parse(filename string, data string, settings, sources map[string]string) error {
+	section := ""
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected key = value", filename, i+1)
+		}
+		key = strings.TrimSpace(key)
+		if section != "" {
+			key = section + "." + key
+		}
+		if _, known := Defaults[key]; !known {
+			return fmt.Errorf("%s:%d: unknown setting %q", filename, i+1, key)
+		}
+		value = strings.TrimSpace(value)
+		if quoted, err := strconv.QuotedPrefix(value); err == nil {
+			value, _ = strconv.Unquote(quoted)
+		} else if before, _, found := strings.Cut(value, "#"); found {
+			value = strings.TrimSpace(before)
+		}
+		settings[key] = value
+		sources[key] = filename
+	}
+	return nil
+}
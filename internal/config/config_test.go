@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "drawsudoku.toml")
+	data := `# a comment
+[store]
+dsn = "user:pw@tcp(db:3306)/sudoku#1"
+
+[theme]
+margin = 8 # mm
+papersize = A5
+`
+	if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DRAWSUDOKU_CONFIG", filename)
+	t.Setenv(Env("theme.papersize"), "Trade")
+
+	settings, sources, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		key, value, source string
+	}{
+		{"store.dsn", "user:pw@tcp(db:3306)/sudoku#1", filename},
+		{"theme.margin", "8", filename},
+		{"theme.papersize", "Trade", "DRAWSUDOKU_THEME_PAPERSIZE"},
+		{"fonts.family", "Helvetica", "default"},
+	} {
+		if settings[c.key] != c.value || sources[c.key] != c.source {
+			t.Errorf("%s = %q from %s, want %q from %s", c.key, settings[c.key], sources[c.key], c.value, c.source)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"unknown.toml": "[theme]\ncolour = red\n",
+		"novalue.toml": "[store]\ndsn\n",
+	} {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("DRAWSUDOKU_CONFIG", filename)
+		if _, _, err := Load(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	// a named file has to be there, the default one doesn't
+	t.Setenv("DRAWSUDOKU_CONFIG", filepath.Join(dir, "missing.toml"))
+	if _, _, err := Load(); err == nil {
+		t.Error("missing DRAWSUDOKU_CONFIG file: no error")
+	}
+}
+
+func TestDifficultiesValue(t *testing.T) {
+	var difficulties []string
+	if err := (DifficultiesValue{Difficulties: &difficulties}).Set("Easy,expert"); err != nil {
+		t.Fatal(err)
+	}
+	if len(difficulties) != 2 || difficulties[0] != "easy" || difficulties[1] != "expert" {
+		t.Errorf("got %v, want [easy expert]", difficulties)
+	}
+	if err := (DifficultiesValue{Difficulties: &difficulties}).Set("easy,hard"); err == nil {
+		t.Error("hard: no error")
+	}
+}
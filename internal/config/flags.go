@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// DifficultyValue is a -difficulty flag: one of the tables, or any
+type DifficultyValue struct {
+	Difficulty *string
+}
+
+func (d DifficultyValue) String() string {
+	if d.Difficulty != nil {
+		return *d.Difficulty
+	}
+	return "any"
+}
+
+func (d DifficultyValue) Set(s string) error {
+	difficulty := strings.ToLower(s)
+	switch difficulty {
+	case "intermediate", "simple", "easy", "expert", "any":
+		*d.Difficulty = difficulty
+		return nil
+	}
+	return errors.New("invalid difficulty value")
+}
+
+// DifficultiesValue is a -difficulty flag that takes a comma separated list
+type DifficultiesValue struct {
+	Difficulties *[]string
+}
+
+func (d DifficultiesValue) String() string {
+	if d.Difficulties != nil {
+		return strings.Join(*d.Difficulties, ",")
+	}
+	return "any"
+}
+
+func (d DifficultiesValue) Set(s string) error {
+	var difficulties []string
+	for _, difficulty := range strings.Split(strings.ToLower(s), ",") {
+		if err := (DifficultyValue{&difficulty}).Set(difficulty); err != nil {
+			return err
+		}
+		difficulties = append(difficulties, difficulty)
+	}
+	*d.Difficulties = difficulties
+	return nil
+}
+
+// SymmetryValue is a -symmetry flag, one of the symmetries of the sudoku
+// package or any
+type SymmetryValue struct {
+	Symmetry *string
+}
+
+func (d SymmetryValue) String() string {
+	if d.Symmetry != nil {
+		return *d.Symmetry
+	}
+	return "any"
+}
+
+func (d SymmetryValue) Set(s string) error {
+	symmetry := strings.ToLower(s)
+	switch symmetry {
+	case "any", "none", "rotate180", "rotate90", "horizontal", "vertical", "diagonal", "dihedral":
+		*d.Symmetry = symmetry
+		return nil
+	}
+	return errors.New("invalid symmetry value")
+}
+
+// OrderValue is an -order flag, the order of the sudokus in a section
+type OrderValue struct {
+	Order *string
+}
+
+func (d OrderValue) String() string {
+	if d.Order != nil {
+		return *d.Order
+	}
+	return "id"
+}
+
+func (d OrderValue) Set(s string) error {
+	order := strings.ToLower(s)
+	switch order {
+	case "id", "ascending", "descending", "random", "interleaved":
+		*d.Order = order
+		return nil
+	}
+	return errors.New("invalid order value")
+}
+
+// OrientationValue is an -orientation flag, L or P
+type OrientationValue struct {
+	Orientation *string
+}
+
+func (d OrientationValue) String() string {
+	if d.Orientation != nil {
+		return *d.Orientation
+	}
+	return "P"
+}
+
+func (d OrientationValue) Set(s string) error {
+	orientation := strings.ToUpper(s)
+	switch orientation {
+	case "L", "P":
+		*d.Orientation = orientation
+		return nil
+	}
+	return errors.New("invalid orientation value")
+}
@@ -0,0 +1,391 @@
+package internal
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schokotets/drawsudokus/internal/book"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+// book metadata written to content.opf
+type bookInfo struct {
+	title    string
+	author   string
+	isbn     string
+	language string
+	volume   int
+}
+
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the tables hold fewer sudokus than the volume needs
+	ErrNotEnoughPuzzles = book.ErrNotEnoughPuzzles
+	// the book can't be written
+	ErrRender = errors.New("writing the epub")
+)
+
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotEnoughPuzzles):
+		return 4
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+// one file of the book, in spine order
+type epubPage struct {
+	id    string
+	href  string
+	title string
+	body  string
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
+	title := flag.String("title", "Sudoku Puzzles", "book title")
+	author := flag.String("author", "ZebiGames", "book author")
+	isbn := flag.String("isbn", "", "ISBN of the ebook edition, if it has one")
+	language := flag.String("language", "en", "book language")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to read from, as user:password@tcp(host:port)/dbname")
+	output := flag.String("output", settings["output.dir"], "directory to write the ebook to")
+	fixture := flag.String("fixture", "", "read the sudokus from this file instead of the database")
+	bookFile := flag.String("book", "", "json file with the sections of the book, as for mix.go; the four levels when empty")
+	flag.Parse()
+
+	v := *volume
+	spec, err := book.Read(*bookFile)
+	if err != nil {
+		fail(err)
+	}
+
+	var sudokus [][]book.Game
+	offsets := book.Offsets(v, spec.Sections)
+	if *fixture != "" {
+		sudokus = make([][]book.Game, len(spec.Sections))
+		for i, section := range spec.Sections {
+			sudokus[i], err = book.ReadFixture(*fixture, section.Shape(), section.Count, offsets[i])
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		var puzzles store.Store
+		if puzzles, err = store.Open(*dsn); err == nil {
+			defer puzzles.Close()
+			sudokus, err = book.Fetch(puzzles, v, spec.Sections, offsets, store.Filter{}, "id", 0)
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	timestamp := time.Now().Format("20060102-150405")
+	name := "mix"
+	if *bookFile != "" {
+		name = strings.TrimSuffix(filepath.Base(*bookFile), filepath.Ext(*bookFile))
+	}
+
+	info := bookInfo{title: *title, author: *author, isbn: *isbn, language: *language, volume: v}
+	filename := filepath.Join(*output, fmt.Sprintf("sudokus-%v-%s-vol-%d.epub", timestamp, name, v))
+	if err := createEPUB(sudokus, spec.Sections, info, filename); err != nil {
+		fail(err)
+	}
+}
+
+// svgGrid draws a game, or its solution, on a canvas of 10 by 10 a cell,
+// with the line width ratios of the pdf files (L/300 and L/120) and cells in
+// the same orientation, a killer's cages and every grid of a samurai
+func svgGrid(game book.Game, solution bool) string {
+	shape := game.Shape()
+	grid := game.Game
+	if solution {
+		grid = game.Solution
+	}
+	side := shape.Width * 10
+	gridL := shape.Size * 10
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="grid" viewBox="-1 -1 %d %d" role="img">`, side+2, side+2)
+	for _, g := range shape.Grids {
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#fff"/>`, g[0]*10, g[1]*10, gridL, gridL)
+	}
+	for _, g := range shape.Grids {
+		x0, y0 := g[0]*10, g[1]*10
+		for l := 0; l <= shape.Size; l++ {
+			p := l * 10
+			w := 0.3
+			if l%shape.BoxW == 0 {
+				w = 0.75
+			}
+			fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#000" stroke-width="%v" stroke-linecap="square"/>`, x0+p, y0, x0+p, y0+gridL, w)
+			w = 0.3
+			if l%shape.BoxH == 0 {
+				w = 0.75
+			}
+			fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#000" stroke-width="%v" stroke-linecap="square"/>`, x0, y0+p, x0+gridL, y0+p, w)
+		}
+	}
+	if cages, _ := sudoku.ParseCages(game.Cages); len(cages) > 0 && !solution {
+		b.WriteString(`<g stroke="#000" stroke-width="0.2" stroke-dasharray="0.7 0.7">`)
+		for _, s := range book.CageSides(shape.Size, cages, 0.1) {
+			fmt.Fprintf(&b, `<line x1="%v" y1="%v" x2="%v" y2="%v"/>`, s[0]*10, s[1]*10, s[2]*10, s[3]*10)
+		}
+		b.WriteString(`</g><g font-family="Helvetica, Arial, sans-serif" font-size="2.5">`)
+		for _, cage := range cages {
+			col, row := book.SumCell(shape.Size, cage)
+			sum := fmt.Sprint(cage.Sum)
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%v" height="2.6" fill="#fff"/><text x="%d" y="%v">%s</text>`, col*10+1, row*10+1, 0.4+1.5*float64(len(sum)), col*10+1, float64(row*10)+3.4, sum)
+		}
+		b.WriteString(`</g>`)
+	}
+	b.WriteString(`<g font-family="Helvetica, Arial, sans-serif" font-size="8" text-anchor="middle">`)
+	board := shape.Board(grid)
+	for i := 0; i < shape.Width; i++ {
+		for j := 0; j < shape.Width; j++ {
+			if n := board[j][i]; n != '.' && n != ' ' {
+				fmt.Fprintf(&b, `<text x="%d" y="%d">%c</text>`, i*10+5, j*10+8, n)
+			}
+		}
+	}
+	b.WriteString(`</g></svg>`)
+	return b.String()
+}
+
+func xhtml(title, language, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="` + language + `" xml:lang="` + language + `">
+<head>
+<meta charset="UTF-8"/>
+<title>` + html.EscapeString(title) + `</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+` + body + `
+</body>
+</html>
+`
+}
+
+const epubCSS = `body { font-family: Helvetica, Arial, sans-serif; text-align: center; }
+h1 { margin-top: 30%; }
+.puzzle, .solution { page-break-before: always; break-before: page; }
+.grid { width: 90%; max-width: 30em; height: auto; }
+.solution .grid { width: 60%; }
+.cages { font-size: 0.8em; text-align: left; }
+a { color: inherit; }
+`
+
+// bookPages lays out the same structure as mix.go: for every section a
+// puzzles title page and the puzzles, then a solutions title page and the
+// solutions unless the section leaves them out, with links between each
+// puzzle and its solution
+func bookPages(sudokus [][]book.Game, sections []book.Section, info bookInfo) []epubPage {
+	var pages []epubPage
+
+	pages = append(pages, epubPage{
+		id:    "title",
+		href:  "title.xhtml",
+		title: info.title,
+		body: fmt.Sprintf(`<section epub:type="titlepage"><h1>%s</h1><p>Volume #%d</p><p>%s</p></section>`,
+			html.EscapeString(info.title), info.volume, html.EscapeString(info.author)),
+	})
+
+	for K, section := range sections {
+		// an untitled section is named after its difficulty, as in the pdf
+		title := section.Title
+		if title == "" {
+			title = strings.Title(section.Difficulty) + " Sudoku"
+		}
+		heading := html.EscapeString(title)
+		puzzles := fmt.Sprintf("puzzles-%d.xhtml", K+1)
+		solutions := fmt.Sprintf("solutions-%d.xhtml", K+1)
+		_, hasSolutions := book.SolutionLayouts[section.Solutions]
+
+		var b strings.Builder
+		fmt.Fprintf(&b, `<section epub:type="chapter"><h1>%s - Puzzles</h1><p>Volume #%d</p></section>`, heading, info.volume)
+		for i, game := range sudokus[K] {
+			link := ""
+			if hasSolutions {
+				link = fmt.Sprintf(`<p><a href="%s#s%d">Solution</a></p>`, solutions, i+1)
+			}
+			cages := ""
+			if text := game.CageText(); text != "" {
+				cages = fmt.Sprintf(`<p class="cages">%s</p>`, html.EscapeString(text))
+			}
+			fmt.Fprintf(&b, `<section class="puzzle" id="p%d"><h2>%s - #%d</h2>%s%s%s</section>`,
+				i+1, heading, i+1, svgGrid(game, false), cages, link)
+		}
+		pages = append(pages, epubPage{id: fmt.Sprintf("puzzles-%d", K+1), href: puzzles, title: title + " - Puzzles", body: b.String()})
+		if !hasSolutions {
+			continue
+		}
+
+		b.Reset()
+		fmt.Fprintf(&b, `<section epub:type="chapter"><h1>%s - Solutions</h1></section>`, heading)
+		for i, game := range sudokus[K] {
+			fmt.Fprintf(&b, `<section class="solution" id="s%d"><h2><a href="%s#p%d">%s - #%d</a></h2>%s</section>`,
+				i+1, puzzles, i+1, heading, i+1, svgGrid(game, true))
+		}
+		pages = append(pages, epubPage{id: fmt.Sprintf("solutions-%d", K+1), href: solutions, title: title + " - Solutions", body: b.String()})
+	}
+
+	return pages
+}
+
+func navDocument(pages []epubPage, info bookInfo) string {
+	var b strings.Builder
+	b.WriteString(`<nav epub:type="toc" id="toc"><h1>Contents</h1><ol>`)
+	for _, page := range pages[1:] {
+		fmt.Fprintf(&b, `<li><a href="%s">%s</a></li>`, page.href, html.EscapeString(page.title))
+	}
+	b.WriteString(`</ol></nav>`)
+	b.WriteString(`<nav epub:type="landmarks" hidden=""><ol>`)
+	fmt.Fprintf(&b, `<li><a epub:type="titlepage" href="%s">Title Page</a></li>`, pages[0].href)
+	fmt.Fprintf(&b, `<li><a epub:type="bodymatter" href="%s">Puzzles</a></li>`, pages[1].href)
+	b.WriteString(`</ol></nav>`)
+	return xhtml(info.title, info.language, b.String())
+}
+
+// packageDocument is content.opf. uuid identifies the book when it has no
+// ISBN.
+func packageDocument(pages []epubPage, info bookInfo, uuid string) string {
+	identifier := "urn:uuid:" + uuid
+	if info.isbn != "" {
+		identifier = "urn:isbn:" + strings.ReplaceAll(info.isbn, "-", "")
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="` + info.language + `">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&b, "<dc:identifier id=\"book-id\">%s</dc:identifier>\n", html.EscapeString(identifier))
+	fmt.Fprintf(&b, "<dc:title>%s</dc:title>\n", html.EscapeString(info.title))
+	fmt.Fprintf(&b, "<dc:creator>%s</dc:creator>\n", html.EscapeString(info.author))
+	fmt.Fprintf(&b, "<dc:language>%s</dc:language>\n", html.EscapeString(info.language))
+	fmt.Fprintf(&b, "<meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	fmt.Fprintf(&b, "<meta property=\"belongs-to-collection\" id=\"series\">%s</meta>\n", html.EscapeString(info.title))
+	b.WriteString("<meta refines=\"#series\" property=\"collection-type\">series</meta>\n")
+	fmt.Fprintf(&b, "<meta refines=\"#series\" property=\"group-position\">%d</meta>\n", info.volume)
+	b.WriteString("</metadata>\n<manifest>\n")
+	b.WriteString("<item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	b.WriteString("<item id=\"style\" href=\"style.css\" media-type=\"text/css\"/>\n")
+	for _, page := range pages {
+		properties := ""
+		if strings.Contains(page.body, "<svg") {
+			properties = ` properties="svg"`
+		}
+		fmt.Fprintf(&b, "<item id=\"%s\" href=\"%s\" media-type=\"application/xhtml+xml\"%s/>\n", page.id, page.href, properties)
+	}
+	b.WriteString("</manifest>\n<spine>\n")
+	for _, page := range pages {
+		fmt.Fprintf(&b, "<itemref idref=\"%s\"/>\n", page.id)
+	}
+	b.WriteString("</spine>\n</package>\n")
+	return b.String()
+}
+
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(rand.Reader, u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+func createEPUB(sudokus [][]book.Game, sections []book.Section, info bookInfo, filename string) error {
+	pages := bookPages(sudokus, sections, info)
+	uuid, err := newUUID()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+
+	// the mimetype has to be the first entry and stored uncompressed
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+`},
+		{"OEBPS/content.opf", packageDocument(pages, info, uuid)},
+		{"OEBPS/nav.xhtml", navDocument(pages, info)},
+		{"OEBPS/style.css", epubCSS},
+	}
+	for _, page := range pages {
+		files = append(files, struct {
+			name    string
+			content string
+		}{"OEBPS/" + page.href, xhtml(page.title, info.language, page.body)})
+	}
+
+	mimetype, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err == nil {
+		_, err = io.WriteString(mimetype, "application/epub+zip")
+	}
+	for _, file := range files {
+		if err != nil {
+			break
+		}
+		var entry io.Writer
+		entry, err = w.Create(file.name)
+		if err == nil {
+			_, err = io.WriteString(entry, file.content)
+		}
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	fmt.Printf("Wrote sudokus to file %s\n", filename)
+	return nil
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the files can't be written
+	ErrRender = errors.New("writing the export")
+)
+
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+type formatValue struct {
+	Format *string
+}
+
+func (d formatValue) String() string {
+	if d.Format != nil {
+		return *d.Format
+	}
+	return "json"
+}
+
+func (d formatValue) Set(s string) error {
+	format := strings.ToLower(s)
+	switch format {
+	case "ipuz", "json", "csv", "oneline":
+		*d.Format = format
+		return nil
+	}
+	return errors.New("invalid format value")
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
+	count := flag.Int("count", 100, "number of sudoku games to fetch")
+	from := flag.Int64("from", 0, "first id to export, selects by id range instead of volume")
+	to := flag.Int64("to", 0, "last id to export, used with -from")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to read from, as user:password@tcp(host:port)/dbname")
+	output := flag.String("output", settings["output.dir"], "directory to write the files to")
+
+	format := "json"
+	flag.Var(&formatValue{&format}, "format", "one of ipuz, json, csv, oneline (qqwing)")
+
+	difficulty := "any"
+	flag.Var(&config.DifficultyValue{Difficulty: &difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+
+	flag.Parse()
+
+	var games []sudoku.Exported
+	if *from > 0 {
+		fmt.Printf("Exporting %s Sudokus %d to %d as %s\n", difficulty, *from, *to, format)
+		games, err = fetchSudokuRange(*dsn, difficulty, *from, *to)
+	} else {
+		fmt.Printf("Exporting %d %s Sudokus of volume %d as %s\n", *count, difficulty, *volume, format)
+		games, err = fetchSudokuGames(*dsn, *count, difficulty, *volume)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	if format == "ipuz" || format == "oneline" {
+		// their grids are classic 9 x 9 ones, the other variants only go to
+		// json and csv
+		classic := games[:0]
+		for _, game := range games {
+			if shape, err := sudoku.NewShape(game.Variant, game.Size); err == nil && shape.Classic() {
+				classic = append(classic, game)
+			}
+		}
+		if skipped := len(games) - len(classic); skipped > 0 {
+			fmt.Printf("Leaving out %d sudokus of other variants than classic 9 x 9, %s only holds those\n", skipped, format)
+		}
+		games = classic
+	}
+
+	timestamp := time.Now().Format("20060102-150405")
+
+	if format == "ipuz" {
+		// an ipuz file holds a single puzzle
+		for _, game := range games {
+			if err := writeExport(filepath.Join(*output, fmt.Sprintf("sudoku-%v-%s-%d.ipuz", timestamp, difficulty, game.ID)), format, []sudoku.Exported{game}); err != nil {
+				fail(err)
+			}
+		}
+		return
+	}
+
+	extension := map[string]string{"json": "json", "csv": "csv", "oneline": "txt"}[format]
+	if err := writeExport(filepath.Join(*output, fmt.Sprintf("sudokus-%v-%s.%s", timestamp, difficulty, extension)), format, games); err != nil {
+		fail(err)
+	}
+}
+
+func fetchSudokuGames(dsn string, amount int, difficulty string, volume int) ([]sudoku.Exported, error) {
+	puzzles, err := store.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer puzzles.Close()
+
+	// lets fetch
+	offset := 0
+	limit := amount
+
+	if volume > 1 {
+		offset = (volume * 100) + 1
+	}
+
+	listed, err := puzzles.List(difficulty, store.Filter{}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return exported(listed), nil
+}
+
+func fetchSudokuRange(dsn string, difficulty string, from, to int64) ([]sudoku.Exported, error) {
+	puzzles, err := store.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer puzzles.Close()
+
+	if to < from {
+		to = from
+	}
+
+	listed, err := puzzles.Between(difficulty, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return exported(listed), nil
+}
+
+// exported turns stored puzzles into the records of the export formats
+func exported(puzzles []store.Puzzle) []sudoku.Exported {
+	var results []sudoku.Exported
+	for _, p := range puzzles {
+		game := sudoku.Exported{ID: p.ID, Difficulty: p.Difficulty, Variant: p.Variant, Size: p.Size, Cages: p.Cages, Givens: p.Givens, Game: p.Game, Solution: p.Solution, Source: p.Source}
+		if p.Score.Valid {
+			score := p.Score.Int64
+			game.Score = &score
+		}
+		results = append(results, game)
+	}
+	return results
+}
+
+func writeExport(filename string, format string, games []sudoku.Exported) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	defer f.Close()
+
+	err = sudoku.WriteExport(f, format, games, time.Now())
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	fmt.Printf("Wrote %d sudokus to file %s\n", len(games), filename)
+	return nil
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/store"
+)
+
+//go:embed html/page.html
+var pageHTML string
+
+//go:embed html/play.css
+var playCSS string
+
+//go:embed html/play.js
+var playJS string
+
+type Game struct {
+	game     string
+	solution string
+}
+
+// data handed to html/page.html
+type htmlPage struct {
+	Title   string
+	CSS     template.CSS
+	JS      template.JS
+	Puzzles []htmlPuzzle
+}
+
+type htmlPuzzle struct {
+	Heading  string
+	Game     string
+	Solution string
+}
+
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the page can't be written
+	ErrRender = errors.New("writing the html")
+)
+
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
+	count := flag.Int("count", 100, "number of sudoku games to fetch")
+	split := flag.Bool("split", false, "write one html file per puzzle instead of a single file")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to read from, as user:password@tcp(host:port)/dbname")
+	output := flag.String("output", settings["output.dir"], "directory to write the html files to")
+
+	difficulty := "any"
+	flag.Var(&config.DifficultyValue{Difficulty: &difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+
+	flag.Parse()
+
+	n := *count
+	v := *volume
+
+	fmt.Printf("Exporting %d %s Sudokus to html\n", n, difficulty)
+
+	sudokus, err := fetchSudokuGames(*dsn, n, difficulty, v)
+	if err != nil {
+		fail(err)
+	}
+
+	timestamp := time.Now().Format("20060102-150405")
+	title := strings.Title(fmt.Sprintf("%s Sudoku - Volume #%d", difficulty, v))
+
+	if !*split {
+		filename := filepath.Join(*output, fmt.Sprintf("sudokus-%v-%s.html", timestamp, difficulty))
+		if err := createHTML(sudokus, 0, title, filename); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	for i := range sudokus {
+		filename := filepath.Join(*output, fmt.Sprintf("sudokus-%v-%s-%d.html", timestamp, difficulty, i+1))
+		if err := createHTML(sudokus[i:i+1], i, fmt.Sprintf("%s - #%d", title, i+1), filename); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fetchSudokuGames(dsn string, amount int, difficulty string, volume int) ([]Game, error) {
+	puzzles, err := store.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer puzzles.Close()
+
+	// lets fetch
+	offset := 0
+	limit := amount
+
+	if volume > 1 {
+		offset = (volume * 100) + 1
+	}
+
+	listed, err := puzzles.List(difficulty, store.Filter{}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Game, len(listed))
+	for k, p := range listed {
+		results[k] = Game{game: p.Game, solution: p.Solution}
+	}
+	return results, nil
+}
+
+// createHTML writes a self-contained page, with the script and styles
+// inlined, so it can be opened offline. first is the index of sudokus[0]
+// within the volume, used for the puzzle numbers.
+func createHTML(sudokus []Game, first int, title string, filename string) error {
+	tmpl, err := template.New("page").Parse(pageHTML)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+
+	page := htmlPage{
+		Title: title,
+		CSS:   template.CSS(playCSS),
+		JS:    template.JS(playJS),
+	}
+	for i, sudoku := range sudokus {
+		page.Puzzles = append(page.Puzzles, htmlPuzzle{
+			Heading:  fmt.Sprintf("Sudoku #%d", first+i+1),
+			Game:     sudoku.game,
+			Solution: sudoku.solution,
+		})
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	defer f.Close()
+
+	err = tmpl.Execute(f, page)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	fmt.Printf("Wrote sudokus to file %s\n", filename)
+	return nil
+}
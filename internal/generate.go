@@ -1,105 +1,591 @@
 package internal
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
 	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
 )
 
-type difficultyValue struct {
-	Difficulty *string
+// a kind of sudoku to generate: its table and its shape
+type kind struct {
+	difficulty string
+	shape      sudoku.Shape
 }
 
-func (d difficultyValue) String() string {
-	if d.Difficulty != nil {
-		return *d.Difficulty
+// name is the difficulty of a classic sudoku, and the shape and difficulty
+// of any other, as a -fill quota names it: killer-easy or classic6-easy
+func (k kind) name() string {
+	if k.shape.Classic() {
+		return k.difficulty
 	}
-	return "simple"
+	return k.shape.Name() + "-" + k.difficulty
 }
 
-func (d difficultyValue) Set(s string) error {
-	difficulty := strings.ToLower(s)
-	switch difficulty {
-	case "intermediate", "simple", "easy", "expert":
-		*d.Difficulty = difficulty
-		return nil
+// a batch of puzzles for one qqwing run
+type job struct {
+	kind   kind
+	amount int
+	index  int // position among the jobs of a run
+	slot   int // position of the first puzzle in the seeded stream
+}
+
+// the puzzles of a finished job
+type batchResult struct {
+	index int
+	name  string // of the job's kind
+	games []store.Puzzle
+	err   error
+}
+
+var (
+	// qqwing is not installed or can't be run
+	ErrGeneratorUnavailable = errors.New("sudoku generator unavailable")
+	// the database can't be reached, read or written
+	ErrStore = store.ErrStore
+)
+
+// exitCode gives every kind of error its own exit status, so scripts like
+// genfill can tell a missing qqwing from a database that is down
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrGeneratorUnavailable):
+		return 3
+	case errors.Is(err, ErrStore):
+		return 5
 	}
-	return errors.New("invalid difficulty value")
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+// counts per difficulty, for the progress report
+type tally struct {
+	target    int
+	generated int
+	stored    int
+}
+
+// configInt reads a number setting
+func configInt(settings map[string]string, key string) int {
+	n, err := strconv.Atoi(settings[key])
+	if err != nil {
+		fail(fmt.Errorf("%s: %q is not a number", key, settings[key]))
+	}
+	return n
 }
 
 func main() {
 
-	nums := flag.Int("nums", 100, "number of sudokus to generate at a time")
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	defaultWorkers := configInt(settings, "generator.workers")
+	if defaultWorkers <= 0 {
+		defaultWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	nums := flag.Int("nums", 100, "number of sudokus to generate at a time, per difficulty")
+	fill := flag.String("fill", "", "file with a target of unused sudokus per difficulty, generate only what the tables are missing")
+	workers := flag.Int("workers", defaultWorkers, "number of generators to run at once")
+	batch := flag.Int("batch", configInt(settings, "generator.batch"), "number of sudokus each generator run makes")
+	generator := flag.String("generator", settings["generator.name"], "one of qqwing, native")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to store into, as user:password@tcp(host:port)/dbname, or memory to keep nothing")
+	seed := flag.Int64("seed", 0, "seed for the native generator, the same seed stores the same sudokus in the same order")
+
+	minGivens := flag.Int("mingivens", 0, "least number of givens (native generator)")
+	maxGivens := flag.Int("maxgivens", 0, "most number of givens (native generator), 0 for no limit")
+	minimal := flag.Bool("minimal", false, "only keep puzzles where removing any given breaks uniqueness (native generator)")
+	interval := flag.Duration("progress", 2*time.Second, "how often to report progress")
+	rescore := flag.Bool("rescore", false, "rate the stored sudokus that have no score yet and exit")
+
+	variant := flag.String("variant", "classic", "variant to generate, one of classic, killer, samurai (native generator)")
+	size := flag.Int("size", 9, "digits of a grid, 4, 6 or 9 (native generator)")
 
-	difficulty := "any"
-	flag.Var(&difficultyValue{&difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+	symmetry := "none"
+	flag.Var(&config.SymmetryValue{Symmetry: &symmetry}, "symmetry", "symmetry of the givens (native generator), one of none, rotate180, rotate90, horizontal, vertical, diagonal, dihedral")
+
+	difficulties := []string{"any"}
+	flag.Var(&config.DifficultiesValue{Difficulties: &difficulties}, "difficulty", "comma separated list of simple, easy, intermediate, expert, any")
 
 	flag.Parse()
 
-	n := *nums
+	shape, err := sudoku.NewShape(*variant, *size)
+	if err != nil {
+		fmt.Printf("invalid -variant or -size: %v\n", err)
+		os.Exit(2)
+	}
+	if !shape.Classic() && (symmetry != "none" || *minGivens != 0 || *maxGivens != 0 || *minimal) {
+		// the symmetries and givens bounds are those of the classic grid
+		fmt.Println("-symmetry, -mingivens, -maxgivens and -minimal only apply to classic 9 x 9 sudokus")
+		os.Exit(2)
+	}
 
-	fmt.Printf("Generating %d %s Sudokus\n", n, difficulty)
+	if *seed != 0 || symmetry != "none" || *minGivens != 0 || *maxGivens != 0 || *minimal || !shape.Classic() {
+		// qqwing can't be seeded, only knows some of the symmetries, has no
+		// say over the givens and only makes classic 9 x 9 sudokus
+		*generator = "native"
+	}
+	if *maxGivens != 0 && (*maxGivens < 17 || *maxGivens < *minGivens) || *minGivens > 80 {
+		fmt.Println("invalid givens range, a unique puzzle needs 17 to 80 givens and -maxgivens can't be below -mingivens")
+		os.Exit(2)
+	}
+	if symmetry == "any" {
+		// filters take any, a generated puzzle has one symmetry or none
+		fmt.Println("invalid symmetry, generate takes none or a symmetry, not any")
+		os.Exit(2)
+	}
+	if *generator != "qqwing" && *generator != "native" {
+		fmt.Println("invalid generator, use qqwing or native")
+		os.Exit(2)
+	}
+	if *batch < 1 || *workers < 1 {
+		// a batch of none never gets a target done
+		fmt.Println("invalid -batch or -workers, both need to be at least 1 (generator.batch and generator.workers in the config)")
+		os.Exit(2)
+	}
+
+	// stop the workers on ^C, whatever was stored so far stays stored
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	out, err := exec.Command("sh", "-c", fmt.Sprintf("qqwing --generate %d --one-line --difficulty %s", n, difficulty)).Output()
+	if *dsn == "memory" {
+		fmt.Println("Storing into memory, nothing is kept after the run")
+	}
+	puzzles, err := store.Open(*dsn)
 	if err != nil {
-		fmt.Printf("Error: %v", err)
-		panic(err)
-		// return nil
+		fail(err)
 	}
-	fmt.Println(string(out))
+	defer puzzles.Close()
 
-	holder := strings.Trim(string(out), "\n")
+	if *rescore {
+		for _, difficulty := range difficulties {
+			scored, err := rescoreSudokus(puzzles, difficulty)
+			if err != nil {
+				fail(err)
+			}
+			fmt.Printf("Scored %d Sudokus in sudoku_%s\n", scored, difficulty)
+		}
+		return
+	}
 
-	games := strings.Split(holder, "\n")
+	p := &pool{store: puzzles, workers: *workers, batch: *batch, interval: *interval, native: *generator == "native",
+		constraints: constraints{seed: *seed, Constraints: sudoku.Constraints{Symmetry: symmetry, MinGivens: *minGivens, MaxGivens: *maxGivens, Minimal: *minimal}}}
+	if p.native && p.constraints.seed == 0 {
+		p.constraints.seed = time.Now().UnixNano()
+	}
+	if p.native {
+		fmt.Printf("Using the native generator with seed %d\n", p.constraints.seed)
+	} else if _, err := exec.LookPath("qqwing"); err != nil {
+		fail(fmt.Errorf("%w: %w, install qqwing or use -generator native", ErrGeneratorUnavailable, err))
+	}
 
-	// generate the results
-	res, err := exec.Command("sh", "-c", "echo \""+holder+"\" | qqwing --solve --one-line").Output()
+	if *fill == "" {
+		var kinds []kind
+		var names []string
+		targets := map[string]int{}
+		for _, difficulty := range difficulties {
+			k := kind{difficulty: difficulty, shape: shape}
+			kinds = append(kinds, k)
+			names = append(names, k.name())
+			targets[k.name()] = *nums
+		}
+		fmt.Printf("Generating %d %s Sudokus with %d workers\n", *nums, strings.Join(names, ", "), *workers)
 
+		if _, err := p.run(ctx, kinds, targets, map[string]int{}); err != nil {
+			fail(err)
+		}
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted, rerun to generate the rest")
+		}
+		return
+	}
+
+	kinds, quotas, err := readTargets(*fill)
 	if err != nil {
-		fmt.Printf("Error: %v", err)
-		panic(err)
-		// return nil
+		fail(err)
+	}
+	for _, k := range kinds {
+		if !k.shape.Classic() && !p.native {
+			fmt.Printf("%s: qqwing only makes classic 9 x 9 sudokus, use -generator native\n", k.name())
+			os.Exit(2)
+		}
 	}
 
-	results := strings.Split(strings.Trim(string(res), "\n"), "\n")
+	// the counts are read from the tables every round, so an interrupted
+	// fill picks up where it stopped, and duplicates qqwing hands out are
+	// made up for in the next round. Only puzzles in no publication count
+	// towards a target. Seeded fills continue the stream at the row count,
+	// which makes a resumed fill store what an uninterrupted one would have.
+	// Every variant and size is counted, and streamed, on its own.
+	for round := 1; ; round++ {
+		missing := map[string]int{}
+		slots := map[string]int{}
+		var todo []kind
+		for _, k := range kinds {
+			filter := store.Filter{Variant: k.shape.Variant, Size: k.shape.Size}
+			rows, err := puzzles.Count(k.difficulty, filter)
+			if err != nil {
+				fail(err)
+			}
+			have, err := puzzles.Unused(k.difficulty, filter)
+			if err != nil {
+				fail(err)
+			}
+			name := k.name()
+			slots[name] = rows
+			if k.shape.Classic() {
+				fmt.Printf("sudoku_%s has %d unused of %d\n", k.difficulty, have, quotas[name])
+			} else {
+				fmt.Printf("sudoku_%s has %d unused %s of %d\n", k.difficulty, have, k.shape.Name(), quotas[name])
+			}
+			if have < quotas[name] {
+				missing[name] = quotas[name] - have
+				todo = append(todo, k)
+			}
+		}
+		if len(todo) == 0 {
+			fmt.Println("All targets are met")
+			return
+		}
 
-	// run the db stuffs
-	db, err := sql.Open("mysql", "root:root@tcp(127.0.0.1:3306)/sudoku")
+		fmt.Printf("Round %d: generating the missing Sudokus with %d workers\n", round, *workers)
+		stored, err := p.run(ctx, todo, missing, slots)
+		if err != nil {
+			fail(err)
+		}
+		if stored == 0 && ctx.Err() == nil {
+			fmt.Println("The generator only produced sudokus that are already stored, giving up")
+			os.Exit(1)
+		}
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted, rerun to generate the rest")
+			return
+		}
+	}
+}
 
-	// if there is an error opening the connection, handle it
-	if err != nil {
-		panic(err.Error())
+// settings shared by every generation run
+type pool struct {
+	store    store.Store
+	workers  int
+	batch    int
+	interval time.Duration
+	native   bool
+
+	// settings for the native generator
+	constraints constraints
+}
+
+// what the native generator's puzzles have to look like, and the seed of
+// their stream
+type constraints struct {
+	seed int64
+	sudoku.Constraints
+}
+
+// run generates targets[name] sudokus of every kind, by the kind's name,
+// storing new ones as they come in, and returns how many were stored. slots
+// gives the position in each kind's seeded stream to start from. A store
+// error or a missing generator stops the run and is returned.
+func (p *pool) run(ctx context.Context, kinds []kind, targets map[string]int, slots map[string]int) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tallies := map[string]*tally{}
+	var names []string
+	for _, k := range kinds {
+		tallies[k.name()] = &tally{target: targets[k.name()]}
+		names = append(names, k.name())
 	}
 
-	// defer the close till after the main function has finished
-	// executing
-	defer db.Close()
+	jobs := make(chan job)
+	go func() {
+		defer close(jobs)
+		index := 0
+		for _, k := range kinds {
+			name := k.name()
+			for done := 0; done < targets[name]; done += p.batch {
+				j := job{kind: k, amount: min(targets[name]-done, p.batch), index: index, slot: slots[name] + done}
+				select {
+				case jobs <- j:
+					index++
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
 
-	// store results
-	for Y := 0; Y < n; Y++ {
+	results := make(chan batchResult)
+	var wg sync.WaitGroup
+	for w := 0; w < p.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var games []store.Puzzle
+				var err error
+				if p.native {
+					games, err = generateNative(ctx, j, p.constraints)
+				} else {
+					games, err = generateSudokus(ctx, j)
+				}
+				if ctx.Err() != nil {
+					err = nil
+				}
+				results <- batchResult{index: j.index, name: j.kind.name(), games: games, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-		// check if value already exists
-		read, err := db.Query("SELECT id FROM sudoku_"+difficulty+" WHERE game=?", games[Y])
-		if err != nil {
-			panic(err.Error())
+	start := time.Now()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	// the first error that stops the run; the workers are cancelled and
+	// their results drained, but nothing more is stored
+	var failed error
+	add := func(name string, games []store.Puzzle) int {
+		stored := 0
+		for _, game := range games {
+			if failed != nil {
+				break
+			}
+			t := tallies[name]
+			t.generated++
+			isNew, err := p.store.Add(game)
+			if err != nil {
+				failed = err
+				cancel()
+			}
+			if isNew {
+				t.stored++
+				stored++
+			}
+		}
+		return stored
+	}
+
+	// store results as they come in; seeded runs store the batches in job
+	// order, so the same seed gives the same ids
+	stored := 0
+	pending := map[int]batchResult{}
+	next := 0
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				report(tallies, names, start)
+				return stored, failed
+			}
+			if failed != nil {
+				continue
+			}
+			if result.err != nil {
+				if errors.Is(result.err, ErrGeneratorUnavailable) {
+					failed = result.err
+					cancel()
+					continue
+				}
+				// a failed qqwing run only costs its batch
+				fmt.Printf("Error: %v\n", result.err)
+			}
+			if !p.native {
+				stored += add(result.name, result.games)
+				continue
+			}
+			pending[result.index] = result
+			for ready, ok := pending[next]; ok; ready, ok = pending[next] {
+				stored += add(ready.name, ready.games)
+				delete(pending, next)
+				next++
+			}
+		case <-ticker.C:
+			report(tallies, names, start)
+		}
+	}
+}
+
+// readTargets reads lines like "expert 500", "classic-expert 500" or
+// "killer-easy 300", with the size after the variant for other sizes than
+// 9 x 9, as in "classic6-easy 100". Blank lines and lines starting with #
+// are skipped. The quotas are by the kind's name.
+func readTargets(filename string) ([]kind, map[string]int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kinds []kind
+	quotas := map[string]int{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("%s:%d: expected a difficulty and a count", filename, i+1)
+		}
+		name := fields[0]
+		shape, _ := sudoku.NewShape("classic", 9)
+		if variant, rest, found := strings.Cut(name, "-"); found {
+			size := 9
+			if digits := strings.TrimLeft(variant, "abcdefghijklmnopqrstuvwxyz"); digits != "" {
+				size, _ = strconv.Atoi(digits)
+				variant = strings.TrimSuffix(variant, digits)
+			}
+			if shape, err = sudoku.NewShape(variant, size); err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %q: %w", filename, i+1, name, err)
+			}
+			name = rest
+		}
+		var difficulty []string
+		if err := (config.DifficultiesValue{Difficulties: &difficulty}).Set(name); err != nil || len(difficulty) != 1 {
+			return nil, nil, fmt.Errorf("%s:%d: %q is not one of simple, easy, intermediate, expert, any", filename, i+1, name)
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count < 0 {
+			return nil, nil, fmt.Errorf("%s:%d: invalid count %q", filename, i+1, fields[1])
+		}
+		k := kind{difficulty: difficulty[0], shape: shape}
+		if _, seen := quotas[k.name()]; !seen {
+			kinds = append(kinds, k)
+		}
+		quotas[k.name()] = count
+	}
+	return kinds, quotas, nil
+}
+
+func generateSudokus(ctx context.Context, j job) ([]store.Puzzle, error) {
+	out, err := exec.CommandContext(ctx, "qqwing", "--generate", strconv.Itoa(j.amount), "--one-line", "--difficulty", j.kind.difficulty).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrGeneratorUnavailable, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("qqwing --generate: %v", err)
+	}
+
+	holder := strings.Trim(string(out), "\n")
+
+	games := strings.Split(holder, "\n")
+
+	// generate the results
+	solve := exec.CommandContext(ctx, "qqwing", "--solve", "--one-line")
+	solve.Stdin = strings.NewReader(holder + "\n")
+	res, err := solve.Output()
+	if err != nil {
+		return nil, fmt.Errorf("qqwing --solve: %v", err)
+	}
+
+	results := strings.Split(strings.Trim(string(res), "\n"), "\n")
+	if len(results) != len(games) {
+		return nil, fmt.Errorf("qqwing solved %d of %d sudokus", len(results), len(games))
+	}
+
+	batch := make([]store.Puzzle, len(games))
+	for i := range games {
+		score := sudoku.Rate(sudoku.Parse(games[i])).Score()
+		batch[i] = store.Puzzle{Difficulty: j.kind.difficulty, Symmetry: sql.NullString{String: "none", Valid: true}, Givens: 81 - strings.Count(games[i], "."), Score: sql.NullInt64{Int64: int64(score), Valid: true}, Game: games[i], Solution: results[i]}
+	}
+	return batch, nil
+}
 
-		// means there's no previous record
-		if read.Next() == false {
-			// // perform a db.Query insert
-			insert, err := db.Query("INSERT INTO sudoku_"+difficulty+"(game, solution) VALUE(?, ?);", games[Y], results[Y])
+// generateNative makes the job's sudokus without qqwing. Every sudoku gets
+// its own random source, seeded from the seed, kind and slot, so the
+// puzzles don't depend on the batch size or on which worker ran the job.
+func generateNative(ctx context.Context, j job, c constraints) ([]store.Puzzle, error) {
+	batch := make([]store.Puzzle, 0, j.amount)
+	shape := j.kind.shape
+	for k := 0; k < j.amount; k++ {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%d/%s/%d", c.seed, j.kind.name(), j.slot+k)
+		rng := rand.New(rand.NewSource(int64(h.Sum64())))
 
-			// // if there is an error inserting, handle it
+		if !shape.Classic() {
+			p, err := shape.Generate(ctx, rng, j.kind.difficulty)
 			if err != nil {
-				panic(err.Error())
+				return batch, err
 			}
-			// be careful deferring Queries if you are using transactions
-			insert.Close()
+			batch = append(batch, store.Puzzle{Difficulty: j.kind.difficulty, Variant: shape.Variant, Size: shape.Size, Cages: sudoku.FormatCages(p.Cages), Symmetry: sql.NullString{String: "none", Valid: true}, Givens: p.Givens, Score: sql.NullInt64{Int64: int64(p.Score), Valid: true}, Game: p.Game, Solution: p.Solution})
+			continue
 		}
+		puzzle, solution, rating, err := sudoku.Generate(ctx, rng, j.kind.difficulty, c.Constraints)
+		if err != nil {
+			return batch, err
+		}
+		batch = append(batch, store.Puzzle{Difficulty: j.kind.difficulty, Symmetry: sql.NullString{String: c.Symmetry, Valid: true}, Givens: puzzle.Givens(), Score: sql.NullInt64{Int64: int64(rating.Score()), Valid: true}, Game: puzzle.String(), Solution: solution.String()})
+	}
+	return batch, nil
+}
+
+// rescoreSudokus rates the sudokus stored without a score, by imports or
+// before scores were kept, and returns how many it scored
+func rescoreSudokus(puzzles store.Store, difficulty string) (int, error) {
+	unscored, err := puzzles.Unscored(difficulty)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range unscored {
+		score := sudoku.Rate(sudoku.Parse(p.Game)).Score()
+		if shape, err := sudoku.NewShape(p.Variant, p.Size); err == nil && !shape.Classic() {
+			// as the generator scores them, by their empty cells
+			score = len(shape.Cells()) - shape.Givens(p.Game)
+		}
+		if err := puzzles.SetScore(difficulty, p.ID, int64(score)); err != nil {
+			return 0, err
+		}
+	}
+	return len(unscored), nil
+}
+
+// report prints throughput, the share of new (not duplicate) sudokus per
+// kind and the expected time left
+func report(tallies map[string]*tally, names []string, start time.Time) {
+	elapsed := time.Since(start)
+	generated, target := 0, 0
+	var parts []string
+	for _, name := range names {
+		t := tallies[name]
+		generated += t.generated
+		target += t.target
+		accepted := 0.
+		if t.generated > 0 {
+			accepted = float64(t.stored) / float64(t.generated) * 100
+		}
+		parts = append(parts, fmt.Sprintf("%s %d/%d (%.0f%% new)", name, t.stored, t.target, accepted))
+	}
+
+	rate := float64(generated) / elapsed.Seconds()
+	eta := "-"
+	if rate > 0 && generated < target {
+		eta = time.Duration(float64(target-generated) / rate * float64(time.Second)).Round(time.Second).String()
 	}
+	fmt.Printf("%s | %.1f sudokus/s | eta %s\n", strings.Join(parts, ", "), rate, eta)
 }
@@ -1,97 +1,106 @@
 package internal
 
 import (
-	"database/sql"
 	"errors"
 	"flag"
 	"fmt"
-	"strings"
+	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/jung-kurt/gofpdf"
+	"github.com/schokotets/drawsudokus/internal/book"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/printpdf"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
 )
 
-type Game struct {
-	game     string `json:"game"`
-	solution string `json:"solution"`
-}
-
-type difficultyValue struct {
-	Difficulty *string
-}
-
-func (d difficultyValue) String() string {
-	if d.Difficulty != nil {
-		return *d.Difficulty
-	}
-	return "any"
-}
-
-func (d difficultyValue) Set(s string) error {
-	difficulty := strings.ToLower(s)
-	switch difficulty {
-	case "intermediate", "simple", "easy", "expert", "any":
-		*d.Difficulty = difficulty
-		return nil
-	}
-	return errors.New("invalid difficulty value")
-}
-
-type paperSizeValue struct {
-	PaperSize *string
-}
-
-func (d paperSizeValue) String() string {
-	if d.PaperSize != nil {
-		return *d.PaperSize
-	}
-	return "Letter"
-}
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the tables hold fewer sudokus than the volume needs
+	ErrNotEnoughPuzzles = book.ErrNotEnoughPuzzles
+	// the pdf can't be drawn or written
+	ErrRender = book.ErrRender
+)
 
-func (d paperSizeValue) Set(s string) error {
-	paperSize := strings.Title(s)
-	switch paperSize {
-	case "A4", "A5", "Letter":
-		*d.PaperSize = paperSize
-		return nil
-	}
-	return errors.New("invalid paper size")
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotEnoughPuzzles):
+		return 4
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
 }
 
-type orientationValue struct {
-	Orientation *string
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
 }
 
-func (d orientationValue) String() string {
-	if d.Orientation != nil {
-		return *d.Orientation
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
 	}
-	return "P"
-}
-
-func (d orientationValue) Set(s string) error {
-	orientation := strings.ToUpper(s)
-	switch orientation {
-	case "L", "P":
-		*d.Orientation = orientation
-		return nil
+	defaultMargin, err := strconv.ParseFloat(settings["theme.margin"], 64)
+	if err != nil {
+		fail(fmt.Errorf("theme.margin: %q is not a number", settings["theme.margin"]))
 	}
-	return errors.New("invalid orientation value")
-}
 
-func main() {
 	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
 	count := flag.Int("count", 100, "number of sudoku games to fetch")
+	seed := flag.Int64("seed", 0, "seed recorded in the pdf. seeded builds get a fixed date and file name so they can be rebuilt byte for byte")
 
 	paperSize := "Letter"
-	flag.Var(&paperSizeValue{&paperSize}, "papersize", "one of A4, A5, Letter")
+	if value := settings["theme.papersize"]; value != "" {
+		if err := (printpdf.PaperSizeValue{PaperSize: &paperSize}).Set(value); err != nil {
+			fail(fmt.Errorf("theme.papersize: %w", err))
+		}
+	}
+	flag.Var(&printpdf.PaperSizeValue{PaperSize: &paperSize}, "papersize", "one of A4, A5, Letter, Trade (6x9in), Digest (5.5x8.5in), Workbook (8x10in), or a size like 170x240mm or 7x10in")
 
 	orientation := "P"
-	flag.Var(&orientationValue{&orientation}, "orientation", "one of L (for landscape), P (for portrait)")
+	if value := settings["theme.orientation"]; value != "" {
+		if err := (config.OrientationValue{Orientation: &orientation}).Set(value); err != nil {
+			fail(fmt.Errorf("theme.orientation: %w", err))
+		}
+	}
+	flag.Var(&config.OrientationValue{Orientation: &orientation}, "orientation", "one of L (for landscape), P (for portrait)")
 
 	difficulty := "any"
-	flag.Var(&difficultyValue{&difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+	flag.Var(&config.DifficultyValue{Difficulty: &difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+
+	symmetry := "any"
+	flag.Var(&config.SymmetryValue{Symmetry: &symmetry}, "symmetry", "only use sudokus with this symmetry, one of any, none, rotate180, rotate90, horizontal, vertical, diagonal, dihedral")
+	showSymmetry := flag.Bool("showsymmetry", false, "print the symmetry of each sudoku in its header")
+	minGivens := flag.Int("mingivens", 0, "only use sudokus with at least this many givens")
+	maxGivens := flag.Int("maxgivens", 0, "only use sudokus with at most this many givens, 0 for no limit")
+	order := "id"
+	flag.Var(&config.OrderValue{Order: &order}, "order", "order of the sudokus in a section, one of id, ascending, descending, random (by -seed), interleaved")
+	candidates := flag.Int("candidates", 0, "pre-fill the candidates of empty cells that have at most this many, 9 for all, 0 for none")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to read from, as user:password@tcp(host:port)/dbname")
+	output := flag.String("output", settings["output.dir"], "directory to write the pdf to")
+	margin := flag.Float64("margin", defaultMargin, "page margin in mm, the layout is built from multiples of it")
+	fixture := flag.String("fixture", "", "read the sudokus from this file instead of the database, for golden.go")
+	publish := flag.Bool("publish", false, "record the file, its seed and its sudokus in the publication ledger of the database")
+	compress := flag.Bool("compress", true, "compress the page contents, turn off to read or diff them")
+	bleed := flag.Float64("bleed", 0, "bleed in mm around every page, for printers that trim the sheet, 3 is common")
+	marks := flag.Bool("marks", false, "draw crop and registration marks around the bleed")
+	tagged := flag.Bool("tagged", false, "write a tagged pdf for screen readers, with headings, a table for every grid, alt text and the grids as text attachments")
+	lang := flag.String("lang", "en-US", "language of a tagged pdf")
+	gutter := 0.
+	flag.Var(&printpdf.GutterValue{Gutter: &gutter}, "gutter", "extra inside margin in mm for binding, or auto to follow the page count")
+	font := flag.String("font", settings["fonts.family"], "one of the pdf core fonts Helvetica, Times, Courier")
+	flagNx := flag.Int("nx", 0, "sudokus put horizontally on a puzzle page, 0 for 2 in landscape and 1 in portrait")
+	flagNy := flag.Int("ny", 0, "sudokus put vertically on a puzzle page, 0 for 1 in landscape and 2 in portrait")
 
 	flag.Parse()
 
@@ -107,274 +116,66 @@ func main() {
 	if orientation == "P" {
 		ny = 2
 	}
-
-	fmt.Printf("Creating %d %s Sudokus in a %d x %d grid\n", n, difficulty, nx, ny)
-
-	sudokus := fetchSudokuGames(n, difficulty, v)
-
-	timestamp := time.Now().Format("20060102-150405")
-
-	filename := fmt.Sprintf("sudokus/sudokus-%v-%dx%d-%s.pdf", timestamp, nx, ny, difficulty)
-	createPDF(sudokus, nx, ny, n, v, difficulty, orientation, filename, paperSize)
-}
-
-func fetchSudokuGames(amount int, difficulty string, volume int) []Game {
-
-	var results = make([]Game, amount)
-	pointer := 0
-	// run the db stuffs
-	db, err := sql.Open("mysql", "root:root@tcp(127.0.0.1:3306)/sudoku")
-
-	// if there is an error opening the connection, handle it
-	if err != nil {
-		panic(err.Error())
+	if *flagNx != 0 {
+		nx = *flagNx
 	}
-
-	// defer the close till after the main function has finished
-	// executing
-	defer db.Close()
-
-	// lets fetch
-	offset := 0
-	limit := amount
-
-	if volume > 1 {
-		offset = (volume * 100) + 1
+	if *flagNy != 0 {
+		ny = *flagNy
 	}
-
-	read, err := db.Query("SELECT game, solution FROM sudoku_"+difficulty+" LIMIT ? OFFSET ?", limit, offset)
-	if err != nil {
-		panic(err.Error())
+	if nx < 1 || ny < 1 || nx > 6 || ny > 6 {
+		fmt.Println("Error: -nx and -ny must be 1 to 6")
+		os.Exit(2)
 	}
 
-	for read.Next() {
-		var game Game
-
-		err = read.Scan(&game.game, &game.solution)
-		if err != nil {
-			panic(err.Error()) // proper error handling instead of panic in your app
-		}
-
-		results[pointer] = game
-		pointer++
+	if *publish && *fixture != "" {
+		fmt.Println("Error: -publish needs the database, fixture sudokus are in no table")
+		os.Exit(2)
 	}
 
-	return results
-}
-
-func smaller(a, b float64) float64 {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-func createPDF(sudokus []Game, nx, ny int, count int, volume int, difficulty string, orientation string, filename string, paperSize string) {
-
-	sudokuIndex := 0
-
-	difficulty = strings.Title(difficulty)
-
-	// title := strings.Title(fmt.Sprintf(difficulty+" Sudoku - Volume #%d - ZebiGames", volume))
-
-	pdf := gofpdf.New(orientation, "mm", paperSize, "")
-	//  pages for prelim
-	// pdf.AddPage()
-	width, height := pdf.GetPageSize()
-	margin := 6. //6 mm
-
-	drawingWidth := width - 5*margin
-	drawingHeight := height - 6*margin
-
-	offsetY := (height - drawingHeight) / 2
-
-	L := smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
-	fieldL := L / 9
-
-	thinLineWidth := L / 300
-	thickLineWidth := L / 120
-
-	//draw title
-	pdf.MoveTo(0, 0)
-	pdf.SetFont("Helvetica", "B", 24)
-	pdf.CellFormat(width, height, fmt.Sprint(difficulty, " Puzzles"), "", 1, "MC", false, 0, "")
-
-	np := count / 2
-
-	for W := 0; W < np; W++ {
-
-		pdf.AddPage()
-		pdf.SetMargins(0, 0, 0)
-		pdf.SetAutoPageBreak(false, 0)
-		pdf.SetDrawColor(0, 0, 0)
-
-		for X := 0; X < nx; X++ {
-			for Y := 0; Y < ny; Y++ {
-
-				x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
-				y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
-
-				// write game number on top
-				pdf.SetFont("Helvetica", "B", fieldL*0.7*2.83)
-				pdf.MoveTo(x0, y0-2*margin)
-				pdf.CellFormat(L, 2*margin, fmt.Sprintf("Sudoku - %s #%d ", difficulty, sudokuIndex+1), "", 0, "MC", false, 0, "")
-
-				// set font for sudoku
-				pdf.SetFont("Helvetica", "", fieldL*0.8*2.83) //2.83 points is a mm
-
-				// draw horizontal lines
-				for ly := 0; ly < 10; ly++ {
-					var w float64
-					if ly%3 == 0 {
-						w = thickLineWidth
-					} else {
-						w = thinLineWidth
-					}
-					pdf.SetLineWidth(w)
-					pdf.Line(x0-w/2, y0+fieldL*float64(ly), x0+w/2+L, y0+fieldL*float64(ly))
-				}
-				// draw vertical lines
-				for lx := 0; lx < 10; lx++ {
-					var w float64
-					if lx%3 == 0 {
-						w = thickLineWidth
-					} else {
-						w = thinLineWidth
-					}
-					pdf.SetLineWidth(w)
-					pdf.Line(x0+fieldL*float64(lx), y0-w/2, x0+fieldL*float64(lx), y0+w/2+L)
-				}
-				// draw numbers
-				for i := 0; i < 9; i++ {
-					for j := 0; j < 9; j++ {
-						n := sudokus[sudokuIndex].game[i*9+j]
-						if string(n) != "." {
-							dy := fieldL / 20
-							pdf.MoveTo(x0+fieldL*float64(i), y0+fieldL*float64(j)+dy)
-
-							//parameters for drawing the number: cell w, h, number, no borders,
-							//don't move, center verically & horizontally, no fill, no link x2
-							pdf.CellFormat(fieldL, fieldL, string(n), "", 0, "CM", false, 0, "")
-						}
-					}
-				}
-				sudokuIndex++
-			}
-		}
+	fmt.Printf("Creating %d %s Sudokus in a %d x %d grid\n", n, difficulty, nx, ny)
 
+	var puzzles store.Store
+	var sudokus []book.Game
+	if *fixture != "" {
+		// sheets are of classic sudokus
+		classic, _ := sudoku.NewShape("classic", 9)
+		sudokus, err = book.ReadFixture(*fixture, classic, n, 0)
+	} else if puzzles, err = store.Open(*dsn); err == nil {
+		defer puzzles.Close()
+		sudokus, err = fetchSudokuGames(puzzles, n, difficulty, v, store.Filter{Symmetry: symmetry, MinGivens: *minGivens, MaxGivens: *maxGivens}, order, book.OrderSeed(order, *seed))
 	}
-
-	// populate answer pages
-	np = count / 6
-	if (count % 6) != 0 {
-		np += 1
+	if err != nil {
+		fail(err)
 	}
 
-	nx = 2
-	ny = 2
-
-	if orientation == "L" {
-		nx = 3
+	filename := filepath.Join(*output, book.FileName(*seed, fmt.Sprintf("%dx%d-%s", nx, ny, difficulty)))
+	data, err := book.Sheets(sudokus, nx, ny, v, difficulty, orientation, paperSize, book.Options{Seed: *seed, ShowSymmetry: *showSymmetry, Candidates: *candidates, Margin: *margin, Font: *font, Compress: *compress, Bleed: *bleed, Marks: *marks, Gutter: gutter, Tagged: *tagged, Lang: *lang})
+	if err == nil {
+		err = os.WriteFile(filename, data, 0644)
 	}
-	if orientation == "P" {
-		ny = 3
+	if err != nil {
+		fail(fmt.Errorf("%w: %s: %w", ErrRender, filename, err))
 	}
+	fmt.Printf("Wrote sudokus to file %s\n", filename)
 
-	sudokuIndex = 0
-
-	drawingWidth = width - 6*margin   // 2 for the heading + 1 left + 1 right
-	drawingHeight = height - 5*margin // 3 top, 1 bottom
-
-	offsetY = (height - drawingHeight) / 2.5
-
-	L = smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
-	fieldL = L / 9
-
-	thinLineWidth = L / 300
-	thickLineWidth = L / 120
-
-	// solutions title
-	pdf.AddPage()
-	pdf.SetMargins(0, 0, 0)
-	pdf.SetAutoPageBreak(false, 0)
-	pdf.SetDrawColor(0, 0, 0)
-
-	//draw title
-	pdf.MoveTo(0, 0)
-	pdf.SetFont("Helvetica", "B", 24)
-	pdf.CellFormat(width, height, fmt.Sprint(difficulty, " Solutions"), "", 1, "MC", false, 0, "")
-
-	// main solutions
-	for W := 0; W < np; W++ {
-
-		pdf.AddPage()
-		pdf.SetMargins(0, 0, 0)
-		pdf.SetAutoPageBreak(false, 0)
-		pdf.SetDrawColor(0, 0, 0)
-
-		for X := 0; X < nx; X++ {
-			for Y := 0; Y < ny; Y++ {
-
-				if sudokuIndex >= count {
-					break
-				}
-				x0 := 4*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
-				y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
-
-				// write game number on top
-				pdf.SetFont("Helvetica", "B", fieldL*0.7*2.83)
-				pdf.MoveTo(x0, y0-1*margin)
-				pdf.CellFormat(L, 1*margin, fmt.Sprintf("Sudoku - %s #%d", strings.Title(difficulty), sudokuIndex+1), "", 0, "MC", false, 0, "")
-
-				// set font for sudoku
-				pdf.SetFont("Helvetica", "", fieldL*0.8*2.83) //2.83 points is a mm
-
-				// draw horizontal lines
-				for ly := 0; ly < 10; ly++ {
-					var w float64
-					if ly%3 == 0 {
-						w = thickLineWidth
-					} else {
-						w = thinLineWidth
-					}
-					pdf.SetLineWidth(w)
-					pdf.Line(x0-w/2, y0+fieldL*float64(ly), x0+w/2+L, y0+fieldL*float64(ly))
-				}
-				// draw vertical lines
-				for lx := 0; lx < 10; lx++ {
-					var w float64
-					if lx%3 == 0 {
-						w = thickLineWidth
-					} else {
-						w = thinLineWidth
-					}
-					pdf.SetLineWidth(w)
-					pdf.Line(x0+fieldL*float64(lx), y0-w/2, x0+fieldL*float64(lx), y0+w/2+L)
-				}
-				// draw numbers
-				for i := 0; i < 9; i++ {
-					for j := 0; j < 9; j++ {
-						n := sudokus[sudokuIndex].solution[i*9+j]
-						if string(n) != "." {
-							dy := fieldL / 20
-							pdf.MoveTo(x0+fieldL*float64(i), y0+fieldL*float64(j)+dy)
-
-							//parameters for drawing the number: cell w, h, number, no borders,
-							//don't move, center verically & horizontally, no fill, no link x2
-							pdf.CellFormat(fieldL, fieldL, string(n), "", 0, "CM", false, 0, "")
-						}
-					}
-				}
-				sudokuIndex++
-			}
+	if *publish {
+		pub := store.Publication{Program: "generatepdf.go", Name: fmt.Sprintf("%dx%d-%s", nx, ny, difficulty), Volume: v, Seed: *seed, File: filename, Created: time.Now()}
+		for _, game := range sudokus {
+			pub.Puzzles = append(pub.Puzzles, store.Mark{Difficulty: difficulty, ID: game.ID})
 		}
-
+		if _, err := puzzles.Publish(pub); err != nil {
+			fail(err)
+		}
+		fmt.Printf("Recorded %s in the publication ledger\n", filename)
 	}
+}
 
-	err := pdf.OutputFileAndClose(filename)
+// fetchSudokuGames reads the volume's sudokus, failing with
+// ErrNotEnoughPuzzles rather than leaving empty games for the pdf
+func fetchSudokuGames(puzzles store.Store, amount int, difficulty string, volume int, filter store.Filter, order string, seed int64) ([]book.Game, error) {
+	games, err := book.Fetch(puzzles, volume, []book.Section{{Difficulty: difficulty, Count: amount}}, []int{book.SheetOffset(volume)}, filter, order, seed)
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Printf("Wrote sudokus to file %s\n", filename)
+		return nil, err
 	}
+	return games[0], nil
 }
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// a pdf or braille layout to check, drawn by running program with args
+type goldenCase struct {
+	name    string
+	program string
+	args    []string
+}
+
+var goldenCases = []goldenCase{
+	{"generatepdf-letter-portrait", "generatepdf.go", []string{"-count", "6", "-difficulty", "easy"}},
+	{"generatepdf-a5-landscape", "generatepdf.go", []string{"-count", "6", "-difficulty", "expert", "-papersize", "A5", "-orientation", "L"}},
+	{"generatepdf-candidates", "generatepdf.go", []string{"-count", "2", "-difficulty", "simple", "-candidates", "9", "-showsymmetry"}},
+	{"generatepdf-tagged", "generatepdf.go", []string{"-count", "2", "-difficulty", "intermediate", "-tagged", "-showsymmetry"}},
+	{"mix", "mix.go", []string{"-volume", "1", "-showsymmetry"}},
+	{"mix-book", "mix.go", []string{"-volume", "1", "-book", filepath.Join("testdata", "book.json")}},
+	// two sections of one difficulty in a later volume, which must not share puzzles
+	{"mix-repeat", "mix.go", []string{"-volume", "2", "-book", filepath.Join("testdata", "repeat.json")}},
+	{"mix-tagged", "mix.go", []string{"-volume", "1", "-book", filepath.Join("testdata", "book.json"), "-tagged", "-bleed", "3", "-marks"}},
+	// sections of 6 x 6, killer and samurai sudokus, tagged for their alt text
+	{"mix-variants", "mix.go", []string{"-volume", "1", "-book", filepath.Join("testdata", "variants.json"), "-tagged"}},
+	{"braille", "braille.go", []string{"-volume", "1", "-book", filepath.Join("testdata", "braille.json"), "-cells", "24", "-lines", "27"}},
+	{"braille-variants", "braille.go", []string{"-volume", "1", "-book", filepath.Join("testdata", "variants.json")}},
+}
+
+// the file each program writes, and the flags that keep it readable
+var goldenOutputs = map[string]struct {
+	ext  string
+	args []string
+}{
+	"generatepdf.go": {".pdf", []string{"-compress=false"}},
+	"mix.go":         {".pdf", []string{"-compress=false"}},
+	"braille.go":     {".brf", nil},
+}
+
+// every case draws the same fixed sudokus, seeded so the dates and file
+// names are pinned. The pdfs get uncompressed pages, see goldenOutputs, so
+// the drawing operators can be compared.
+var goldenArgs = []string{"-fixture", filepath.Join("testdata", "fixture.txt"), "-seed", "1"}
+
+func main() {
+	update := flag.Bool("update", false, "write the current output as the new golden files")
+	run := flag.String("run", "", "only check the layouts whose name contains this")
+	context := flag.Int("context", 3, "lines of context around every change")
+	flag.Parse()
+
+	failed := 0
+	for _, c := range goldenCases {
+		if !strings.Contains(c.name, *run) {
+			continue
+		}
+		filename := filepath.Join("testdata", "golden", c.name+".txt.gz")
+
+		got, err := renderGolden(c)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", c.name, err)
+			failed++
+			continue
+		}
+
+		if *update {
+			if err := writeGolden(filename, got); err != nil {
+				fmt.Printf("FAIL %s: %v\n", c.name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("wrote %s\n", filename)
+			continue
+		}
+
+		want, err := readGolden(filename)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v, run with -update to create it\n", c.name, err)
+			failed++
+			continue
+		}
+		if diff := lineDiff(want, got, *context); diff != "" {
+			fmt.Printf("FAIL %s: the output differs from %s\n%s", c.name, filename, diff)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", c.name)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d layouts changed, rerun with -update if that was intended\n", failed)
+		os.Exit(1)
+	}
+}
+
+// renderGolden runs the case's program into a fresh directory, away from
+// any drawsudoku.toml or DRAWSUDOKU_* settings, and returns its file as lines
+func renderGolden(c goldenCase) ([]string, error) {
+	dir, err := os.MkdirTemp("", "golden-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := append([]string{"run", filepath.Join("internal", c.program)}, c.args...)
+	args = append(args, goldenArgs...)
+	args = append(args, goldenOutputs[c.program].args...)
+	args = append(args, "-output", dir)
+
+	cmd := exec.Command("go", args...)
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "DRAWSUDOKU_") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, "DRAWSUDOKU_CONFIG="+os.DevNull)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+
+	ext := goldenOutputs[c.program].ext
+	files, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("expected one %s file, %s wrote %d", ext, c.program, len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		return nil, err
+	}
+	if ext == ".brf" {
+		// the lines keep their CR, the pages their form feed
+		return strings.Split(strings.TrimRight(string(data), "\n"), "\n"), nil
+	}
+	return normalizePDF(data), nil
+}
+
+// normalizePDF keeps the objects of an uncompressed pdf, one operator or
+// dictionary per line, and drops the cross-reference table at the end,
+// whose byte offsets change with every other change
+func normalizePDF(data []byte) []string {
+	if i := bytes.LastIndex(data, []byte("\nxref\n")); i >= 0 {
+		data = data[:i+1]
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+func readGolden(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n"), nil
+}
+
+// writeGolden stores the lines gzipped, a book's worth of drawing
+// operators is mostly the same few lines over and over
+func writeGolden(filename string, lines []string) error {
+	var b bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b.Bytes(), 0644)
+}
+
+// lineDiff shows how got differs from want like diff -u does, with line
+// numbers of want, or returns "" when they are the same. Long runs of
+// changes are cut short, the first ones tell what happened.
+func lineDiff(want, got []string, context int) string {
+	// the lines both start and end with are not part of the diff
+	prefix := 0
+	for prefix < len(want) && prefix < len(got) && want[prefix] == got[prefix] {
+		prefix++
+	}
+	if prefix == len(want) && prefix == len(got) {
+		return ""
+	}
+	suffix := 0
+	for suffix < len(want)-prefix && suffix < len(got)-prefix && want[len(want)-1-suffix] == got[len(got)-1-suffix] {
+		suffix++
+	}
+	a := want[prefix : len(want)-suffix]
+	b := got[prefix : len(got)-suffix]
+
+	// edit script of the middle, from the longest common subsequence when
+	// that is small enough to work out, else everything removed and added
+	type edit struct {
+		op   byte
+		line string
+	}
+	var edits []edit
+	if len(a)*len(b) <= 4000000 {
+		lcs := make([][]int32, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				edits = append(edits, edit{' ', a[i]})
+				i++
+				j++
+			case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+				edits = append(edits, edit{'-', a[i]})
+				i++
+			default:
+				edits = append(edits, edit{'+', b[j]})
+				j++
+			}
+		}
+	} else {
+		for _, line := range a {
+			edits = append(edits, edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{'+', line})
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "@@ line %d @@\n", prefix+1)
+	for _, line := range want[max(0, prefix-context):prefix] {
+		fmt.Fprintf(&out, "  %s\n", line)
+	}
+
+	const limit = 60
+	shown, run := 0, 0
+	for k, e := range edits {
+		if e.op == ' ' {
+			run++
+			// keep context around changes, fold the rest of a long run
+			next := k + 1
+			for next < len(edits) && edits[next].op == ' ' {
+				next++
+			}
+			if run <= context || next-k <= context && next < len(edits) {
+				fmt.Fprintf(&out, "  %s\n", e.line)
+			} else if run == context+1 {
+				out.WriteString("  ...\n")
+			}
+			continue
+		}
+		run = 0
+		if shown == limit {
+			changed := 0
+			for _, e := range edits[k:] {
+				if e.op != ' ' {
+					changed++
+				}
+			}
+			fmt.Fprintf(&out, "... and %d more changed lines\n", changed)
+			return out.String()
+		}
+		fmt.Fprintf(&out, "%c %s\n", e.op, e.line)
+		shown++
+	}
+
+	for _, line := range want[len(want)-suffix : min(len(want), len(want)-suffix+context)] {
+		fmt.Fprintf(&out, "  %s\n", line)
+	}
+	return out.String()
+}
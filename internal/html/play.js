@@ -0,0 +1,218 @@
+(function () {
+  "use strict";
+
+  // cells are stored in the same order as the pdf files draw them: the game
+  // string runs down the columns, so row r, column c is index c*9 + r
+  function index(r, c) {
+    return c * 9 + r;
+  }
+
+  function peers(i, j) {
+    var ri = i % 9, ci = Math.floor(i / 9);
+    var rj = j % 9, cj = Math.floor(j / 9);
+    if (i === j) {
+      return false;
+    }
+    return ri === rj || ci === cj ||
+      (Math.floor(ri / 3) === Math.floor(rj / 3) && Math.floor(ci / 3) === Math.floor(cj / 3));
+  }
+
+  function Puzzle(section) {
+    this.game = section.dataset.game;
+    this.solution = section.dataset.solution;
+    this.grid = section.querySelector(".grid");
+    this.status = section.querySelector(".status");
+    this.pencilButton = section.querySelector(".pencil");
+    this.pencil = false;
+    this.selected = -1;
+    this.values = [];
+    this.marks = [];
+    this.cells = [];
+
+    for (var r = 0; r < 9; r++) {
+      for (var c = 0; c < 9; c++) {
+        var i = index(r, c);
+        var cell = document.createElement("div");
+        cell.className = "cell";
+        if (c % 3 === 2 && c < 8) {
+          cell.classList.add("box-right");
+        }
+        if (r % 3 === 2 && r < 8) {
+          cell.classList.add("box-bottom");
+        }
+        cell.dataset.index = i;
+        this.grid.appendChild(cell);
+        this.cells[i] = cell;
+      }
+    }
+
+    var self = this;
+    this.grid.addEventListener("click", function (e) {
+      var cell = e.target.closest(".cell");
+      if (cell) {
+        self.select(+cell.dataset.index);
+        self.grid.focus();
+      }
+    });
+    this.grid.addEventListener("keydown", function (e) {
+      self.key(e);
+    });
+    this.pencilButton.addEventListener("click", function () {
+      self.pencil = !self.pencil;
+      self.pencilButton.textContent = "Pencil: " + (self.pencil ? "on" : "off");
+      self.grid.focus();
+    });
+    section.querySelector(".check").addEventListener("click", function () {
+      self.check();
+    });
+    section.querySelector(".reset").addEventListener("click", function () {
+      self.reset();
+    });
+
+    this.reset();
+  }
+
+  Puzzle.prototype.reset = function () {
+    for (var i = 0; i < 81; i++) {
+      var ch = this.game.charAt(i);
+      this.values[i] = ch >= "1" && ch <= "9" ? ch : "";
+      this.marks[i] = {};
+      this.cells[i].classList.toggle("given", this.values[i] !== "");
+    }
+    this.status.textContent = "";
+    this.render();
+  };
+
+  Puzzle.prototype.isGiven = function (i) {
+    return this.cells[i].classList.contains("given");
+  };
+
+  Puzzle.prototype.select = function (i) {
+    this.selected = i;
+    this.render();
+  };
+
+  Puzzle.prototype.key = function (e) {
+    if (this.selected < 0) {
+      this.selected = 0;
+    }
+    var r = this.selected % 9, c = Math.floor(this.selected / 9);
+    var moves = { ArrowUp: [-1, 0], ArrowDown: [1, 0], ArrowLeft: [0, -1], ArrowRight: [0, 1] };
+
+    if (moves[e.key]) {
+      r = (r + moves[e.key][0] + 9) % 9;
+      c = (c + moves[e.key][1] + 9) % 9;
+      this.select(index(r, c));
+      e.preventDefault();
+      return;
+    }
+
+    // shifted digits arrive as symbols on most layouts, so read the key code
+    var digit = /^Digit[1-9]$|^Numpad[1-9]$/.test(e.code) ? e.code.slice(-1) : "";
+    if (digit) {
+      this.enter(digit, this.pencil || e.shiftKey);
+      e.preventDefault();
+    } else if (e.key === "Backspace" || e.key === "Delete" || e.key === "0") {
+      this.clear();
+      e.preventDefault();
+    } else if (e.key === "p") {
+      this.pencilButton.click();
+    }
+  };
+
+  Puzzle.prototype.enter = function (digit, pencil) {
+    var i = this.selected;
+    if (this.isGiven(i)) {
+      return;
+    }
+    if (pencil) {
+      if (this.values[i] !== "") {
+        return;
+      }
+      if (this.marks[i][digit]) {
+        delete this.marks[i][digit];
+      } else {
+        this.marks[i][digit] = true;
+      }
+    } else {
+      this.values[i] = this.values[i] === digit ? "" : digit;
+      if (this.values[i] !== "") {
+        // a placed digit removes the same pencil mark from its peers
+        for (var j = 0; j < 81; j++) {
+          if (peers(i, j)) {
+            delete this.marks[j][digit];
+          }
+        }
+      }
+    }
+    this.status.textContent = "";
+    this.render();
+  };
+
+  Puzzle.prototype.clear = function () {
+    var i = this.selected;
+    if (this.isGiven(i)) {
+      return;
+    }
+    this.values[i] = "";
+    this.marks[i] = {};
+    this.render();
+  };
+
+  Puzzle.prototype.check = function () {
+    var wrong = 0, empty = 0;
+    for (var i = 0; i < 81; i++) {
+      var bad = this.values[i] !== "" && this.values[i] !== this.solution.charAt(i);
+      this.cells[i].classList.toggle("wrong", bad);
+      if (bad) {
+        wrong++;
+      }
+      if (this.values[i] === "") {
+        empty++;
+      }
+    }
+    if (wrong > 0) {
+      this.status.textContent = wrong + (wrong === 1 ? " cell is" : " cells are") + " wrong";
+    } else if (empty > 0) {
+      this.status.textContent = "So far so good, " + empty + " to go";
+    } else {
+      this.status.textContent = "Solved!";
+    }
+  };
+
+  Puzzle.prototype.render = function () {
+    for (var i = 0; i < 81; i++) {
+      var cell = this.cells[i];
+      var conflict = false;
+      if (this.values[i] !== "") {
+        for (var j = 0; j < 81; j++) {
+          if (peers(i, j) && this.values[j] === this.values[i]) {
+            conflict = true;
+            break;
+          }
+        }
+      }
+      cell.classList.toggle("entry", !this.isGiven(i) && this.values[i] !== "");
+      cell.classList.toggle("conflict", conflict);
+      cell.classList.toggle("selected", i === this.selected);
+      cell.classList.toggle("peer", this.selected >= 0 && peers(i, this.selected));
+      cell.classList.remove("wrong");
+
+      cell.textContent = this.values[i];
+      if (this.values[i] === "") {
+        var marks = document.createElement("div");
+        marks.className = "marks";
+        for (var d = 1; d <= 9; d++) {
+          var mark = document.createElement("span");
+          mark.textContent = this.marks[i][d] ? d : "";
+          marks.appendChild(mark);
+        }
+        cell.appendChild(marks);
+      }
+    }
+  };
+
+  document.querySelectorAll(".puzzle").forEach(function (section) {
+    new Puzzle(section);
+  });
+})();
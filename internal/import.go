@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+// the database can't be reached or written
+var ErrStore = store.ErrStore
+
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	if errors.Is(err, ErrStore) {
+		return 5
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+type formatValue struct {
+	Format *string
+}
+
+func (d formatValue) String() string {
+	if d.Format != nil {
+		return *d.Format
+	}
+	return "auto"
+}
+
+func (d formatValue) Set(s string) error {
+	format := strings.ToLower(s)
+	switch format {
+	case "auto", "oneline", "sdk", "ss", "sdm", "grid", "csv", "json", "ipuz":
+		*d.Format = format
+		return nil
+	}
+	return errors.New("invalid format value")
+}
+
+// an imported puzzle, in the qqwing one-line form used by the database
+type importedGame struct {
+	game     string
+	solution string
+	source   string
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	source := flag.String("source", "", "provenance stored with every puzzle, defaults to the file name")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to store into, as user:password@tcp(host:port)/dbname, or memory to keep nothing")
+
+	format := "auto"
+	flag.Var(&formatValue{&format}, "format", "one of auto, oneline (qqwing), sdk (SadMan), ss (Simple Sudoku), sdm (SudoCue), grid, csv, json, ipuz (export.go)")
+
+	difficulty := "any"
+	flag.Var(&config.DifficultyValue{Difficulty: &difficulty}, "difficulty", "table to store into, one of simple, easy, intermediate, expert, any")
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Println("usage: import [options] file...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	var games []importedGame
+	rejected := 0
+
+	for _, filename := range flag.Args() {
+		f := format
+		if f == "auto" {
+			f = detectFormat(filename)
+		}
+
+		puzzles, err := readPuzzles(filename, f)
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", filename, err))
+		}
+
+		src := *source
+		if src == "" {
+			src = filepath.Base(filename)
+		}
+
+		for i, puzzle := range puzzles {
+			solution, err := sudoku.SolveUnique(puzzle)
+			if err != nil {
+				fmt.Printf("Skipping %s puzzle #%d: %v\n", filename, i+1, err)
+				rejected++
+				continue
+			}
+			games = append(games, importedGame{game: puzzle, solution: solution, source: fmt.Sprintf("%s#%d", src, i+1)})
+		}
+	}
+
+	fmt.Printf("Importing %d %s Sudokus (%d rejected)\n", len(games), difficulty, rejected)
+
+	if *dsn == "memory" {
+		fmt.Println("Storing into memory, nothing is kept after the run")
+	}
+	stored, err := storeGames(*dsn, games, difficulty)
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("Stored %d new Sudokus, %d were already in sudoku_%s\n", stored, len(games)-stored, difficulty)
+}
+
+func detectFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".sdk":
+		return "sdk"
+	case ".ss":
+		return "ss"
+	case ".sdm":
+		return "sdm"
+	case ".csv":
+		return "csv"
+	case ".txt":
+		return "grid"
+	case ".json":
+		return "json"
+	case ".ipuz":
+		return "ipuz"
+	}
+	return "oneline"
+}
+
+func readPuzzles(filename string, format string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return sudoku.ReadPuzzles(f, format)
+}
+
+func storeGames(dsn string, games []importedGame, difficulty string) (int, error) {
+	puzzles, err := store.Open(dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer puzzles.Close()
+
+	stored := 0
+	for _, game := range games {
+		// a table holds every game once, Add skips the ones it has
+		isNew, err := puzzles.Add(store.Puzzle{Difficulty: difficulty, Givens: 81 - strings.Count(game.game, "."), Game: game.game, Solution: game.solution, Source: game.source})
+		if err != nil {
+			return stored, err
+		}
+		if isNew {
+			stored++
+		}
+	}
+	return stored, nil
+}
@@ -1,324 +1,150 @@
 package internal
 
 import (
-	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/jung-kurt/gofpdf"
+	"github.com/schokotets/drawsudokus/internal/book"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/printpdf"
+	"github.com/schokotets/drawsudokus/internal/store"
 )
 
-type Game struct {
-	game     string `json:"game"`
-	solution string `json:"solution"`
-}
-
-func main() {
-	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
-	flag.Parse()
-
-	nx := 1
-	ny := 2
-	v := *volume
-	levels := [4]string{"simple", "easy", "intermediate", "expert"}
-
-	sudokus := fetchSudokuGames(v, levels)
-
-	timestamp := time.Now().Format("20060102-150405")
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the tables hold fewer sudokus than the volume needs
+	ErrNotEnoughPuzzles = book.ErrNotEnoughPuzzles
+	// the pdf can't be drawn or written
+	ErrRender = book.ErrRender
+)
 
-	filename := fmt.Sprintf("sudokus/sudokus-%v-%dx%d-%s-vol-%d.pdf", timestamp, nx, ny, "mix", v)
-	createPDF(sudokus, nx, ny, v, levels, filename)
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNotEnoughPuzzles):
+		return 4
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
 }
 
-func fetchSudokuGames(volume int, levels [4]string) [][]Game {
-
-	var results = make([][]Game, 4)
-	multipier := 50
-	basesize := [4]int{1, 1, 3, 6}
-	// run the db stuffs
-	db, err := sql.Open("mysql", "root:root@tcp(127.0.0.1:3306)/sudoku")
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
 
-	// if there is an error opening the connection, handle it
+func main() {
+	settings, _, err := config.Load()
 	if err != nil {
-		panic(err.Error())
+		fail(err)
+	}
+	defaultMargin, err := strconv.ParseFloat(settings["theme.margin"], 64)
+	if err != nil {
+		fail(fmt.Errorf("theme.margin: %q is not a number", settings["theme.margin"]))
 	}
 
-	// defer the close till after the main function has finished
-	// executing
-	defer db.Close()
-
-	for i := 0; i < 4; i++ {
-		// lets fetch
-		offset := 0
-		limit := basesize[i] * multipier
-		difficulty := levels[i]
-		results[i] = make([]Game, (limit - offset))
-
-		if volume > 1 {
-			offset = ((volume - 1) * basesize[i] * multipier) + 1
-		}
+	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
+	seed := flag.Int64("seed", 0, "seed recorded in the pdf. seeded builds get a fixed date and file name so they can be rebuilt byte for byte")
 
-		read, err := db.Query("SELECT game, solution FROM sudoku_"+difficulty+" LIMIT ? OFFSET ?", limit, offset)
-		if err != nil {
-			panic(err.Error())
+	paperSize := "Letter"
+	if value := settings["theme.papersize"]; value != "" {
+		if err := (printpdf.PaperSizeValue{PaperSize: &paperSize}).Set(value); err != nil {
+			fail(fmt.Errorf("theme.papersize: %w", err))
 		}
+	}
+	flag.Var(&printpdf.PaperSizeValue{PaperSize: &paperSize}, "papersize", "one of A4, A5, Letter, Trade (6x9in), Digest (5.5x8.5in), Workbook (8x10in), or a size like 170x240mm or 7x10in")
+
+	symmetry := "any"
+	flag.Var(&config.SymmetryValue{Symmetry: &symmetry}, "symmetry", "only use sudokus with this symmetry, one of any, none, rotate180, rotate90, horizontal, vertical, diagonal, dihedral")
+	showSymmetry := flag.Bool("showsymmetry", false, "print the symmetry of each sudoku in its header")
+	minGivens := flag.Int("mingivens", 0, "only use sudokus with at least this many givens")
+	maxGivens := flag.Int("maxgivens", 0, "only use sudokus with at most this many givens, 0 for no limit")
+	order := "id"
+	flag.Var(&config.OrderValue{Order: &order}, "order", "order of the sudokus in a section, one of id, ascending, descending, random (by -seed), interleaved")
+	candidates := flag.Int("candidates", 0, "pre-fill the candidates of empty cells that have at most this many, 9 for all, 0 for none")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to read from, as user:password@tcp(host:port)/dbname")
+	output := flag.String("output", settings["output.dir"], "directory to write the pdf to")
+	margin := flag.Float64("margin", defaultMargin, "page margin in mm, the layout is built from multiples of it")
+	fixture := flag.String("fixture", "", "read the sudokus from this file instead of the database, for golden.go")
+	publish := flag.Bool("publish", false, "record the file, its seed and its sudokus in the publication ledger of the database")
+	compress := flag.Bool("compress", true, "compress the page contents, turn off to read or diff them")
+	bleed := flag.Float64("bleed", 0, "bleed in mm around every page, for printers that trim the sheet, 3 is common")
+	marks := flag.Bool("marks", false, "draw crop and registration marks around the bleed")
+	tagged := flag.Bool("tagged", false, "write a tagged pdf for screen readers, with headings, a table for every grid, alt text and the grids as text attachments")
+	lang := flag.String("lang", "en-US", "language of a tagged pdf")
+	gutter := 0.
+	flag.Var(&printpdf.GutterValue{Gutter: &gutter}, "gutter", "extra inside margin in mm for binding, or auto to follow the page count")
+	font := flag.String("font", settings["fonts.family"], "one of the pdf core fonts Helvetica, Times, Courier")
+	bookFile := flag.String("book", "", "json file with the sections of the book, see book.json; the four levels when empty")
 
-		pointer := 0
+	flag.Parse()
 
-		for read.Next() {
-			var game Game
+	v := *volume
+	if *publish && *fixture != "" {
+		fmt.Println("Error: -publish needs the database, fixture sudokus are in no table")
+		os.Exit(2)
+	}
+	spec, err := book.Read(*bookFile)
+	if err != nil {
+		fail(err)
+	}
 
-			err = read.Scan(&game.game, &game.solution)
+	offsets := book.Offsets(v, spec.Sections)
+	var puzzles store.Store
+	var sudokus [][]book.Game
+	if *fixture != "" {
+		for i, s := range spec.Sections {
+			var section []book.Game
+			section, err = book.ReadFixture(*fixture, s.Shape(), s.Count, offsets[i])
 			if err != nil {
-				panic(err.Error()) // proper error handling instead of panic in your app
+				break
 			}
-
-			results[i][pointer] = game
-
-			pointer++
+			sudokus = append(sudokus, section)
 		}
+	} else if puzzles, err = store.Open(*dsn); err == nil {
+		defer puzzles.Close()
+		sudokus, err = book.Fetch(puzzles, v, spec.Sections, offsets, store.Filter{Symmetry: symmetry, MinGivens: *minGivens, MaxGivens: *maxGivens}, order, book.OrderSeed(order, *seed))
 	}
-
-	return results
-}
-
-func smaller(a, b float64) float64 {
-	if a < b {
-		return a
+	if err != nil {
+		fail(err)
 	}
-	return b
-}
-
-func createPDF(sudokus [][]Game, nx, ny int, volume int, levels [4]string, filename string) {
-
-	pdf := gofpdf.New("P", "mm", "Letter", "")
-	// prelim pages
-	pdf.AddPage()
-	pdf.AddPage()
-	pdf.AddPage()
-	pdf.AddPage()
-
-	// continue
-	width, height := pdf.GetPageSize()
-	margin := 6. //6 mm
-	basenx := nx
-	baseny := ny
-	sudokuIndex := 0
-
-	// let's get this looping
-	for K := 0; K < 4; K++ {
-
-		difficulty := strings.Title(levels[K])
-		count := len(sudokus[K])
-
-		nx = basenx
-		ny = baseny
-
-		sudokuIndex = 0
-
-		drawingWidth := width - 6*margin
-		drawingHeight := height - 6*margin
 
-		offsetY := (height - drawingHeight) / 2.5
-
-		L := smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
-		fieldL := L / 9
-
-		thinLineWidth := L / 300
-		thickLineWidth := L / 120
-
-		pdf.AddPage()
-		pdf.SetMargins(0, 0, 0)
-		pdf.SetAutoPageBreak(false, 0)
-		pdf.SetDrawColor(0, 0, 0)
-
-		//draw title
-		pdf.MoveTo(0, 0)
-		pdf.SetFont("Helvetica", "B", 24)
-		pdf.CellFormat(width, height, fmt.Sprint(difficulty, " Sudoku - Puzzles"), "", 1, "MC", false, 0, "")
-		pdf.CellFormat(width, height, fmt.Sprint("Volume #", volume), "", 1, "MC", false, 0, "")
-
-		np := count / 2
-
-		for W := 0; W < np; W++ {
-
-			pdf.AddPage()
-			pdf.SetMargins(0, 0, 0)
-			pdf.SetAutoPageBreak(false, 0)
-			pdf.SetDrawColor(0, 0, 0)
-
-			for X := 0; X < nx; X++ {
-				for Y := 0; Y < ny; Y++ {
-
-					x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
-					y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
-
-					// write game number on top
-					pdf.SetFont("Helvetica", "B", fieldL*0.7*2.83)
-					pdf.MoveTo(x0, y0-2*margin)
-					pdf.CellFormat(L, 2*margin, fmt.Sprintf("%s Sudoku - #%d ", difficulty, sudokuIndex+1), "", 0, "MC", false, 0, "")
-
-					// set font for sudoku
-					pdf.SetFont("Helvetica", "", fieldL*0.8*2.83) //2.83 points is a mm
-
-					// draw horizontal lines
-					for ly := 0; ly < 10; ly++ {
-						var w float64
-						if ly%3 == 0 {
-							w = thickLineWidth
-						} else {
-							w = thinLineWidth
-						}
-						pdf.SetLineWidth(w)
-						pdf.Line(x0-w/2, y0+fieldL*float64(ly), x0+w/2+L, y0+fieldL*float64(ly))
-					}
-					// draw vertical lines
-					for lx := 0; lx < 10; lx++ {
-						var w float64
-						if lx%3 == 0 {
-							w = thickLineWidth
-						} else {
-							w = thinLineWidth
-						}
-						pdf.SetLineWidth(w)
-						pdf.Line(x0+fieldL*float64(lx), y0-w/2, x0+fieldL*float64(lx), y0+w/2+L)
-					}
-					// draw numbers
-
-					for i := 0; i < 9; i++ {
-						for j := 0; j < 9; j++ {
-							n := sudokus[K][sudokuIndex].game[i*9+j]
-							if string(n) != "." {
-								dy := fieldL / 20
-								pdf.MoveTo(x0+fieldL*float64(i), y0+fieldL*float64(j)+dy)
+	name := "1x2-mix"
+	if *bookFile != "" {
+		name = strings.TrimSuffix(filepath.Base(*bookFile), filepath.Ext(*bookFile))
+	}
+	filename := filepath.Join(*output, book.FileName(*seed, fmt.Sprintf("%s-vol-%d", name, v)))
+	data, err := book.Mix(sudokus, spec.Sections, v, paperSize, book.Options{Seed: *seed, ShowSymmetry: *showSymmetry, Candidates: *candidates, Margin: *margin, Font: *font, Compress: *compress, Bleed: *bleed, Marks: *marks, Gutter: gutter, Tagged: *tagged, Lang: *lang})
+	if err == nil {
+		err = os.WriteFile(filename, data, 0644)
+	}
+	if err != nil {
+		fail(fmt.Errorf("%w: %s: %w", ErrRender, filename, err))
+	}
+	fmt.Printf("Wrote sudokus to file %s\n", filename)
 
-								//parameters for drawing the number: cell w, h, number, no borders,
-								//don't move, center verically & horizontally, no fill, no link x2
-								pdf.CellFormat(fieldL, fieldL, string(n), "", 0, "CM", false, 0, "")
-							}
-						}
-					}
-					sudokuIndex++
-				}
-				pdf.MoveTo(0, height-(3.5*margin))
-				pdf.SetFont("Helvetica", "", 14)
-				pdf.CellFormat(0, 2*margin, fmt.Sprintf("%d", pdf.PageNo()), "0", 0, "MC", false, 0, "")
+	if *publish {
+		pub := store.Publication{Program: "mix.go", Name: name, Volume: v, Seed: *seed, File: filename, Created: time.Now()}
+		for i, section := range spec.Sections {
+			for _, game := range sudokus[i] {
+				pub.Puzzles = append(pub.Puzzles, store.Mark{Difficulty: section.Difficulty, ID: game.ID})
 			}
-
 		}
-
-		// populate answer pages
-		np = count / 6
-		if (count % 6) != 0 {
-			np += 1
+		if _, err := puzzles.Publish(pub); err != nil {
+			fail(err)
 		}
-
-		nx = 2
-		ny = 3
-
-		sudokuIndex = 0
-
-		drawingWidth = width - 6*margin
-		drawingHeight = height - 6*margin
-
-		offsetY = (height - drawingHeight) / 2.5
-
-		L = smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
-		fieldL = L / 9
-
-		thinLineWidth = L / 300
-		thickLineWidth = L / 120
-
-		// solutions title
-		pdf.AddPage()
-		pdf.SetMargins(0, 0, 0)
-		pdf.SetAutoPageBreak(false, 0)
-		pdf.SetDrawColor(0, 0, 0)
-
-		//draw title
-		pdf.MoveTo(0, 0)
-		pdf.SetFont("Helvetica", "B", 24)
-		pdf.CellFormat(width, height, fmt.Sprint(difficulty, " Sudoku - Solutions"), "", 1, "MC", false, 0, "")
-
-		// main solutions
-		for W := 0; W < np; W++ {
-
-			pdf.AddPage()
-			pdf.SetMargins(0, 0, 0)
-			pdf.SetAutoPageBreak(false, 0)
-			pdf.SetDrawColor(0, 0, 0)
-
-			for X := 0; X < nx; X++ {
-				for Y := 0; Y < ny; Y++ {
-
-					if sudokuIndex >= count {
-						break
-					}
-					x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
-					y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
-
-					// write game number on top
-					pdf.SetFont("Helvetica", "B", fieldL*0.7*2.83)
-					pdf.MoveTo(x0, y0-1*margin)
-					pdf.CellFormat(L, 1*margin, fmt.Sprintf("%s Sudoku - #%d", strings.Title(difficulty), sudokuIndex+1), "", 0, "MC", false, 0, "")
-
-					// set font for sudoku
-					pdf.SetFont("Helvetica", "", fieldL*0.8*2.83) //2.83 points is a mm
-
-					// draw horizontal lines
-					for ly := 0; ly < 10; ly++ {
-						var w float64
-						if ly%3 == 0 {
-							w = thickLineWidth
-						} else {
-							w = thinLineWidth
-						}
-						pdf.SetLineWidth(w)
-						pdf.Line(x0-w/2, y0+fieldL*float64(ly), x0+w/2+L, y0+fieldL*float64(ly))
-					}
-					// draw vertical lines
-					for lx := 0; lx < 10; lx++ {
-						var w float64
-						if lx%3 == 0 {
-							w = thickLineWidth
-						} else {
-							w = thinLineWidth
-						}
-						pdf.SetLineWidth(w)
-						pdf.Line(x0+fieldL*float64(lx), y0-w/2, x0+fieldL*float64(lx), y0+w/2+L)
-					}
-					// draw numbers
-					for i := 0; i < 9; i++ {
-						for j := 0; j < 9; j++ {
-							n := sudokus[K][sudokuIndex].solution[i*9+j]
-							if string(n) != "." {
-								dy := fieldL / 20
-								pdf.MoveTo(x0+fieldL*float64(i), y0+fieldL*float64(j)+dy)
-
-								//parameters for drawing the number: cell w, h, number, no borders,
-								//don't move, center verically & horizontally, no fill, no link x2
-								pdf.CellFormat(fieldL, fieldL, string(n), "", 0, "CM", false, 0, "")
-							}
-						}
-					}
-					sudokuIndex++
-				}
-				// Page number
-				pdf.MoveTo(0, height-(3.5*margin))
-				pdf.SetFont("Helvetica", "", 14)
-				pdf.CellFormat(0, 2*margin, fmt.Sprintf("%d", pdf.PageNo()), "0", 0, "MC", false, 0, "")
-			}
-
-		}
-	}
-
-	err := pdf.OutputFileAndClose(filename)
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Printf("Wrote sudokus to file %s\n", filename)
+		fmt.Printf("Recorded %s in the publication ledger\n", filename)
 	}
 }
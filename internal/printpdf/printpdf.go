@@ -0,0 +1,273 @@
+// Package printpdf starts the pdfs of the programs that print books, with
+// the paper sizes they take and what a printer needs around the page: a
+// bleed, crop and registration marks and the TrimBox and BleedBox that say
+// where the sheet is cut.
+package printpdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PaperSizes are the portrait sizes in mm of the named paper sizes
+var PaperSizes = map[string][2]float64{
+	"A4":       {210, 297},
+	"A5":       {148.5, 210},   // gofpdf's, ISO is 148
+	"Letter":   {215.9, 279.4}, // 8.5 x 11 in
+	"Trade":    {152.4, 228.6}, // 6 x 9 in
+	"Digest":   {139.7, 215.9}, // 5.5 x 8.5 in
+	"Workbook": {203.2, 254},   // 8 x 10 in
+}
+
+// PageSize returns the portrait size in mm of one of PaperSizes, or of a
+// size given as width x height in mm or inches, like 170x240mm or 7x10in
+func PageSize(s string) ([2]float64, error) {
+	if size, ok := PaperSizes[strings.Title(strings.ToLower(s))]; ok {
+		return size, nil
+	}
+
+	s = strings.ToLower(s)
+	unit := 1.
+	switch {
+	case strings.HasSuffix(s, "mm"):
+		s = strings.TrimSuffix(s, "mm")
+	case strings.HasSuffix(s, "in"):
+		s = strings.TrimSuffix(s, "in")
+		unit = 25.4
+	default:
+		return [2]float64{}, errors.New("invalid paper size")
+	}
+	w, h, ok := strings.Cut(s, "x")
+	if !ok {
+		return [2]float64{}, errors.New("invalid paper size")
+	}
+	width, err := strconv.ParseFloat(w, 64)
+	if err != nil {
+		return [2]float64{}, errors.New("invalid paper size")
+	}
+	height, err := strconv.ParseFloat(h, 64)
+	if err != nil {
+		return [2]float64{}, errors.New("invalid paper size")
+	}
+	width, height = width*unit, height*unit
+	if width < 50 || height < 50 || width > 1000 || height > 1000 {
+		return [2]float64{}, errors.New("paper size out of range, 50 to 1000 mm a side")
+	}
+	return [2]float64{width, height}, nil
+}
+
+// PaperSizeValue is a -papersize flag, anything PageSize takes. The named
+// sizes are kept by their own name, so titles and file names read the same.
+type PaperSizeValue struct {
+	PaperSize *string
+}
+
+func (d PaperSizeValue) String() string {
+	if d.PaperSize != nil {
+		return *d.PaperSize
+	}
+	return "Letter"
+}
+
+func (d PaperSizeValue) Set(s string) error {
+	if _, err := PageSize(s); err != nil {
+		return err
+	}
+	for name := range PaperSizes {
+		if strings.EqualFold(name, s) {
+			s = name
+		}
+	}
+	*d.PaperSize = s
+	return nil
+}
+
+// AutoGutter asks for the gutter that suits the page count of the book
+const AutoGutter = -1
+
+// GutterValue is a -gutter flag, in mm or auto for AutoGutter
+type GutterValue struct {
+	Gutter *float64
+}
+
+func (d GutterValue) String() string {
+	if d.Gutter == nil || *d.Gutter == 0 {
+		return "0"
+	}
+	if *d.Gutter == AutoGutter {
+		return "auto"
+	}
+	return strconv.FormatFloat(*d.Gutter, 'f', -1, 64)
+}
+
+func (d GutterValue) Set(s string) error {
+	if strings.EqualFold(s, "auto") {
+		*d.Gutter = AutoGutter
+		return nil
+	}
+	gutter, err := strconv.ParseFloat(s, 64)
+	if err != nil || gutter < 0 {
+		return errors.New("invalid gutter, give it in mm or as auto")
+	}
+	*d.Gutter = gutter
+	return nil
+}
+
+// slug is the room in mm outside the bleed for the marks
+const slug = 12.
+
+// Options are what New puts around the page for the printer
+type Options struct {
+	Bleed  float64 // mm added on every side of the trimmed page
+	Marks  bool    // crop and registration marks outside the bleed
+	Gutter float64 // mm added to the inside margin for binding
+	Tagged bool    // the pdf gets Tags, which need the rest marked as artifacts
+}
+
+// New starts a pdf whose pages are trimmed to paperSize, one PageSize
+// takes. A bleed makes the sheet larger by that much on every side, and
+// marks add a slug around it for crop and registration marks. A gutter
+// widens the inside margin for binding, on the left of right-hand pages and
+// the right of left-hand ones. Pages are drawn in the coordinates of what
+// is left, the header moves the origin there and the footer draws the
+// marks, so the layouts don't need to know about any of it. The width
+// returned is that of the layout, without the gutter.
+//
+// Write the pdf with Output, which puts the page boxes in a fixed order.
+func New(orientation string, paperSize string, o Options) (*gofpdf.Fpdf, float64, float64) {
+	bleed, marks, gutter := o.Bleed, o.Marks, o.Gutter
+	size, err := PageSize(paperSize)
+	width, height := size[0], size[1]
+	if orientation == "L" {
+		width, height = height, width
+	}
+
+	edge := bleed
+	if marks {
+		edge += slug
+	}
+	var pdf *gofpdf.Fpdf
+	if edge == 0 {
+		// gofpdf has its own sizes in points, a hair off the mm above
+		pdf = gofpdf.New(orientation, "mm", paperSize, "")
+		if pdf.Ok() {
+			width, height = pdf.GetPageSize()
+		}
+	}
+	if pdf == nil || !pdf.Ok() {
+		// the size is already turned by orientation
+		pdf = gofpdf.NewCustom(&gofpdf.InitType{
+			OrientationStr: "P",
+			UnitStr:        "mm",
+			Size:           gofpdf.SizeType{Wd: width + 2*edge, Ht: height + 2*edge},
+		})
+	}
+	if err != nil {
+		pdf.SetError(err)
+		return pdf, width, height
+	}
+	if edge == 0 && gutter == 0 {
+		return pdf, width, height
+	}
+
+	// pages break where they would on the trimmed page
+	pdf.SetAutoPageBreak(true, 20+2*edge)
+	// the media box is the whole sheet. The boxes are centred, so the
+	// offsets are the same from the top as from the bottom. Without marks
+	// the sheet ends at the bleed, which is where a missing BleedBox ends
+	// too; with them the BleedBox is the trim box grown by the bleed, the
+	// trim box itself when there is none
+	if edge > 0 {
+		pdf.SetPageBox("trim", edge, edge, width, height)
+	}
+	if marks {
+		pdf.SetPageBox("bleed", slug, slug, width+2*bleed, height+2*bleed)
+	}
+	// gofpdf wants every TransformBegin ended before it closes the last
+	// page, ahead of its footer, so the translation is written directly.
+	// A tagged pdf marks it and the marks as artifacts, not part of the text
+	k := pdf.GetConversionRatio()
+	artifact := func(draw func()) {
+		if o.Tagged {
+			pdf.RawWriteStr("/Artifact BMC")
+		}
+		draw()
+		if o.Tagged {
+			pdf.RawWriteStr("EMC")
+		}
+	}
+	pdf.SetHeaderFunc(func() {
+		x := edge
+		if pdf.PageNo()%2 == 1 {
+			x += gutter
+		}
+		artifact(func() { pdf.RawWriteStr(fmt.Sprintf("q 1 0 0 1 %.5f %.5f cm", x*k, (0-edge)*k)) })
+	})
+	pdf.SetFooterFunc(func() {
+		artifact(func() {
+			pdf.RawWriteStr("Q")
+			if marks {
+				drawMarks(pdf, edge, width, height, bleed)
+			}
+		})
+	})
+	return pdf, width - gutter, height
+}
+
+// drawMarks draws crop marks at the corners of the trim box, starting
+// outside the bleed, and a registration mark at the middle of every side
+func drawMarks(pdf *gofpdf.Fpdf, edge, width, height, bleed float64) {
+	const length = 8.
+	offset := bleed + 2
+
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetLineWidth(0.1)
+	for _, x := range []float64{edge, edge + width} {
+		for _, y := range []float64{edge, edge + height} {
+			dx, dy := 1., 1.
+			if x == edge {
+				dx = -1
+			}
+			if y == edge {
+				dy = -1
+			}
+			pdf.Line(x+dx*offset, y, x+dx*(offset+length), y)
+			pdf.Line(x, y+dy*offset, x, y+dy*(offset+length))
+		}
+	}
+
+	centre := bleed + 6
+	for _, p := range [][2]float64{
+		{edge + width/2, edge - centre},
+		{edge + width/2, edge + height + centre},
+		{edge - centre, edge + height/2},
+		{edge + width + centre, edge + height/2},
+	} {
+		pdf.Circle(p[0], p[1], 3, "D")
+		pdf.Circle(p[0], p[1], 1.5, "D")
+		pdf.Line(p[0]-4, p[1], p[0]+4, p[1])
+		pdf.Line(p[0], p[1]-4, p[0], p[1]+4)
+	}
+}
+
+// boxes are the two page boxes New sets, in the order gofpdf may also
+// write them in
+var boxes = regexp.MustCompile(`(/BleedBox \[[^\]]*\]\n)(/TrimBox \[[^\]]*\]\n)`)
+
+// Output closes the pdf and returns its bytes. gofpdf writes the page boxes
+// in map order, so a seeded build would come out either way; Output puts the
+// TrimBox first. Swapping two lines of the same page object keeps every
+// offset of the cross-reference table.
+func Output(pdf *gofpdf.Fpdf) ([]byte, error) {
+	var b bytes.Buffer
+	if err := pdf.Output(&b); err != nil {
+		return nil, err
+	}
+	return boxes.ReplaceAll(b.Bytes(), []byte("$2$1")), nil
+}
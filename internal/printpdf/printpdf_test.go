@@ -0,0 +1,81 @@
+package printpdf
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPageSize(t *testing.T) {
+	for _, c := range []struct {
+		size string
+		want [2]float64
+		ok   bool
+	}{
+		{"A5", [2]float64{148.5, 210}, true},
+		{"letter", [2]float64{215.9, 279.4}, true},
+		{"170x240mm", [2]float64{170, 240}, true},
+		{"10x20in", [2]float64{254, 508}, true},
+		{"170x240", [2]float64{}, false},
+		{"10x240mm", [2]float64{}, false},
+		{"axbmm", [2]float64{}, false},
+	} {
+		got, err := PageSize(c.size)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("PageSize(%q) = %v, %v, want %v", c.size, got, err, c.want)
+		}
+	}
+}
+
+// pages matches the boxes of every page, the media box is the same for all
+// of them and written once
+var pages = regexp.MustCompile(`/Type /Page\n/Parent 1 0 R\n((?:/\w+Box \[[^\]]*\]\n)*)`)
+
+func render(t *testing.T, bleed float64, marks bool) []byte {
+	t.Helper()
+	pdf, _, _ := New("P", "A5", Options{Bleed: bleed, Marks: marks})
+	date := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	pdf.SetCreationDate(date)
+	pdf.SetModificationDate(date)
+	pdf.SetCatalogSort(true)
+	for i := 0; i < 3; i++ {
+		pdf.AddPage()
+	}
+	data, err := Output(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBoxes(t *testing.T) {
+	for _, c := range []struct {
+		bleed float64
+		marks bool
+		want  string
+	}{
+		{0, false, ""},
+		{3, false, "/TrimBox [8.50 8.50 429.45 603.78]\n"},
+		// the bleed box is the trim box when there is no bleed
+		{0, true, "/TrimBox [34.02 34.02 454.96 629.29]\n/BleedBox [34.02 34.02 454.96 629.29]\n"},
+		{3, true, "/TrimBox [42.52 42.52 463.46 637.80]\n/BleedBox [34.02 34.02 471.97 646.30]\n"},
+	} {
+		// map order is random on every run, so a few of them have to agree
+		first := render(t, c.bleed, c.marks)
+		for i := 0; i < 20; i++ {
+			if !bytes.Equal(render(t, c.bleed, c.marks), first) {
+				t.Fatalf("bleed %g, marks %v: two builds differ", c.bleed, c.marks)
+			}
+		}
+		boxes := pages.FindAllSubmatch(first, -1)
+		if len(boxes) != 3 {
+			t.Fatalf("bleed %g, marks %v: found the boxes of %d pages, want 3", c.bleed, c.marks, len(boxes))
+		}
+		for _, b := range boxes {
+			if string(b[1]) != c.want {
+				t.Errorf("bleed %g, marks %v: page boxes\n%s\nwant\n%s", c.bleed, c.marks, b[1], c.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package printpdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Elem is an element of the structure tree of a tagged pdf, holding
+// either marked content of one page or other elements
+type Elem struct {
+	role  string // standard structure type, like H1, Table or TD
+	alt   string
+	page  int   // page of the marked content
+	mcids []int // marked content on that page
+	kids  []*Elem
+	ref   int // object number, given when the tree is written
+}
+
+// Tags marks content of the page streams as it is drawn and collects the
+// structure tree that Write adds to the pdf. Its methods do nothing on
+// a nil *Tags, so the layout draws the same way with tagging off.
+type Tags struct {
+	pdf  *gofpdf.Fpdf
+	root Elem
+	// the elements the marked content of every page belongs to, by id
+	owners map[int][]*Elem
+}
+
+func NewTags(pdf *gofpdf.Fpdf) *Tags {
+	return &Tags{pdf: pdf, root: Elem{role: "Document"}, owners: map[int][]*Elem{}}
+}
+
+// Elem adds an element under parent, or under the document for nil
+func (t *Tags) Elem(parent *Elem, role, alt string) *Elem {
+	if t == nil {
+		return nil
+	}
+	if parent == nil {
+		parent = &t.root
+	}
+	e := &Elem{role: role, alt: alt}
+	parent.kids = append(parent.kids, e)
+	return e
+}
+
+// Begin starts content of e on the current page, up to the next End
+func (t *Tags) Begin(e *Elem) {
+	if t == nil {
+		return
+	}
+	page := t.pdf.PageNo()
+	mcid := len(t.owners[page])
+	t.owners[page] = append(t.owners[page], e)
+	e.page = page
+	e.mcids = append(e.mcids, mcid)
+	t.pdf.RawWriteStr(fmt.Sprintf("/%s <</MCID %d>> BDC", e.role, mcid))
+}
+
+// Artifact starts content that is only decoration, like grid lines
+func (t *Tags) Artifact() {
+	if t == nil {
+		return
+	}
+	t.pdf.RawWriteStr("/Artifact BMC")
+}
+
+func (t *Tags) End() {
+	if t == nil {
+		return
+	}
+	t.pdf.RawWriteStr("EMC")
+}
+
+// GridTable adds a table with a row element for every printed row of a
+// board width cells across and down and a cell element for every cell,
+// which the digits are drawn into
+func (t *Tags) GridTable(parent *Elem, alt string, width int) [][]*Elem {
+	cells := make([][]*Elem, width)
+	table := t.Elem(parent, "Table", alt)
+	for row := 0; row < width; row++ {
+		tr := t.Elem(table, "TR", "")
+		cells[row] = make([]*Elem, width)
+		for col := 0; col < width; col++ {
+			cells[row][col] = t.Elem(tr, "TD", "")
+		}
+	}
+	return cells
+}
+
+// GridText writes a board as it is printed, a string a row as
+// sudoku.Shape.Board lays it out, with the boxes of boxW by boxH cells set
+// apart, dots for the empty cells and spaces between a samurai's grids
+func GridText(board []string, boxW, boxH int) string {
+	rows := make([]string, len(board))
+	for row, cells := range board {
+		var b strings.Builder
+		for col := 0; col < len(cells); col++ {
+			if col > 0 && col%boxW == 0 {
+				b.WriteString("| ")
+			}
+			b.WriteByte(cells[col])
+			if col < len(cells)-1 {
+				b.WriteByte(' ')
+			}
+		}
+		rows[row] = b.String()
+	}
+
+	var b strings.Builder
+	for row, line := range rows {
+		if row > 0 && row%boxH == 0 {
+			// the line between bands crosses the lines between boxes
+			b.WriteString(strings.Map(func(r rune) rune {
+				if r == '|' {
+					return '+'
+				}
+				return '-'
+			}, line) + "\n")
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// GridAlt describes a board to a screen reader, row by row. what says what
+// the board is, like a 9 by 9 grid; the cells between a samurai's grids are
+// gaps.
+func GridAlt(title string, board []string, what string) string {
+	givens := 0
+	rows := make([]string, len(board))
+	for row, line := range board {
+		cells := make([]string, len(line))
+		for col := 0; col < len(line); col++ {
+			switch n := line[col]; n {
+			case '.':
+				cells[col] = "blank"
+			case ' ':
+				cells[col] = "gap"
+			default:
+				cells[col] = string(n)
+				givens++
+			}
+		}
+		rows[row] = fmt.Sprintf("row %d: %s", row+1, strings.Join(cells, " "))
+	}
+	return fmt.Sprintf("%s, %s with %d digits filled in. %s.", title, what, givens, strings.Join(rows, ", "))
+}
+
+// pdfText is a pdf text string, literal for ascii and utf-16 otherwise
+func pdfText(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r >= 0x80 {
+			ascii = false
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	trailerPattern   = regexp.MustCompile(`(?s)trailer\s*<<(.*?)>>\s*startxref`)
+	kidsPattern      = regexp.MustCompile(`/Type /Pages\s*/Kids \[([^\]]*)\]`)
+)
+
+// Write adds the structure tree to the pdf Output returned, as gofpdf has no
+// way to make one itself. It appends an incremental update, as a pdf editor
+// would: the catalog and the pages again with the entries of a tagged pdf in
+// lang, the structure elements, and a cross-reference section for them.
+func (t *Tags) Write(data []byte, lang string) ([]byte, error) {
+	m := startxrefPattern.FindSubmatch(data)
+	trailer := trailerPattern.FindAllSubmatch(data, -1)
+	kids := kidsPattern.FindSubmatch(data)
+	if m == nil || trailer == nil || kids == nil {
+		return nil, errors.New("tagging: unexpected pdf layout")
+	}
+	prev, _ := strconv.Atoi(string(m[1]))
+	dict := string(trailer[len(trailer)-1][1])
+	var size, root, info int
+	fmt.Sscanf(dict[strings.Index(dict, "/Size"):], "/Size %d", &size)
+	fmt.Sscanf(dict[strings.Index(dict, "/Root"):], "/Root %d", &root)
+	if i := strings.Index(dict, "/Info"); i >= 0 {
+		fmt.Sscanf(dict[i:], "/Info %d", &info)
+	}
+	var pages []int
+	for _, field := range strings.Fields(string(kids[1])) {
+		if n, err := strconv.Atoi(field); err == nil && field != "0" {
+			pages = append(pages, n)
+		}
+	}
+	object := func(n int) (string, error) {
+		start := bytes.Index(data, []byte(fmt.Sprintf("\n%d 0 obj\n", n)))
+		if start < 0 {
+			return "", fmt.Errorf("tagging: no object %d", n)
+		}
+		body := data[start+len(fmt.Sprintf("\n%d 0 obj\n", n)):]
+		end := bytes.Index(body, []byte("\nendobj"))
+		if end < 0 {
+			return "", fmt.Errorf("tagging: object %d has no end", n)
+		}
+		return strings.TrimSpace(string(body[:end])), nil
+	}
+
+	// number the new objects: the tree root, the parent tree, then every
+	// element from the document down
+	next := size
+	treeRoot, parentTree := next, next+1
+	next += 2
+	var elems []*Elem
+	var number func(e *Elem)
+	number = func(e *Elem) {
+		e.ref = next
+		next++
+		elems = append(elems, e)
+		for _, kid := range e.kids {
+			number(kid)
+		}
+	}
+	number(&t.root)
+
+	var out bytes.Buffer
+	out.Write(data)
+	offsets := map[int]int{}
+	write := func(n int, body string) {
+		offsets[n] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", n, body)
+	}
+
+	catalog, err := object(root)
+	if err != nil {
+		return nil, err
+	}
+	write(root, strings.TrimSuffix(catalog, ">>")+fmt.Sprintf("/Lang %s\n/MarkInfo <</Marked true>>\n/StructTreeRoot %d 0 R\n/ViewerPreferences <</DisplayDocTitle true>>\n/Version /1.7\n>>", pdfText(lang), treeRoot))
+	for i, n := range pages {
+		page, err := object(n)
+		if err != nil {
+			return nil, err
+		}
+		write(n, strings.TrimSuffix(page, ">>")+fmt.Sprintf("\n/StructParents %d\n/Tabs /S>>", i))
+	}
+
+	write(treeRoot, fmt.Sprintf("<</Type /StructTreeRoot\n/K %d 0 R\n/ParentTree %d 0 R\n/ParentTreeNextKey %d>>", t.root.ref, parentTree, len(pages)))
+	var nums strings.Builder
+	for i := range pages {
+		fmt.Fprintf(&nums, "%d [", i)
+		for _, e := range t.owners[i+1] {
+			fmt.Fprintf(&nums, "%d 0 R ", e.ref)
+		}
+		nums.WriteString("] ")
+	}
+	write(parentTree, fmt.Sprintf("<</Nums [%s]>>", nums.String()))
+
+	parents := map[*Elem]int{&t.root: treeRoot}
+	for _, e := range elems {
+		var b strings.Builder
+		fmt.Fprintf(&b, "<</Type /StructElem\n/S /%s\n/P %d 0 R", e.role, parents[e])
+		if e.alt != "" {
+			fmt.Fprintf(&b, "\n/Alt %s", pdfText(e.alt))
+		}
+		b.WriteString("\n/K [")
+		if len(e.mcids) > 0 {
+			for _, mcid := range e.mcids {
+				fmt.Fprintf(&b, "%d ", mcid)
+			}
+		}
+		for _, kid := range e.kids {
+			parents[kid] = e.ref
+			fmt.Fprintf(&b, "%d 0 R ", kid.ref)
+		}
+		b.WriteString("]")
+		if len(e.mcids) > 0 {
+			fmt.Fprintf(&b, "\n/Pg %d 0 R", pages[e.page-1])
+		}
+		b.WriteString(">>")
+		write(e.ref, b.String())
+	}
+
+	// one subsection for every object, in order
+	xref := out.Len()
+	numbers := make([]int, 0, len(offsets))
+	for n := range offsets {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	out.WriteString("xref\n")
+	for _, n := range numbers {
+		fmt.Fprintf(&out, "%d 1\n%010d 00000 n \n", n, offsets[n])
+	}
+	fmt.Fprintf(&out, "trailer\n<<\n/Size %d\n/Root %d 0 R\n", next, root)
+	if info != 0 {
+		fmt.Fprintf(&out, "/Info %d 0 R\n", info)
+	}
+	fmt.Fprintf(&out, "/Prev %d\n>>\nstartxref\n%d\n%%%%EOF\n", prev, xref)
+	return out.Bytes(), nil
+}
@@ -0,0 +1,420 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/printpdf"
+	"github.com/schokotets/drawsudokus/internal/store"
+)
+
+type Game struct {
+	game     string
+	solution string
+}
+
+// raster options shared by the grid and page modes
+type rasterStyle struct {
+	antialias   bool
+	transparent bool
+	background  image.Image
+	solutions   bool
+}
+
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the images can't be drawn or written
+	ErrRender = errors.New("rendering the image")
+)
+
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	volume := flag.Int("volume", 1, "volume number. 1 for first 100, 2 for 101 to 200")
+	count := flag.Int("count", 1, "number of sudoku games to fetch")
+	mode := flag.String("mode", "grid", "one of grid (a single square grid per image), page (a full page preview)")
+	size := flag.Int("size", 1200, "width and height in pixels of a grid image")
+	dpi := flag.Float64("dpi", 150, "resolution of a page image")
+	format := flag.String("format", "png", "one of png, jpeg")
+	antialias := flag.Bool("antialias", true, "smooth the edges of lines and digits")
+	transparent := flag.Bool("transparent", false, "leave the background transparent (png only)")
+	background := flag.String("background", "", "background image from backgrounds/, e.g. 4.jpg")
+	solutions := flag.Bool("solutions", false, "draw the solutions instead of the puzzles")
+	dsn := flag.String("dsn", settings["store.dsn"], "database to read from, as user:password@tcp(host:port)/dbname")
+	output := flag.String("output", settings["output.dir"], "directory to write the images to")
+
+	paperSize := "Letter"
+	flag.Var(&printpdf.PaperSizeValue{PaperSize: &paperSize}, "papersize", "one of A4, A5, Letter, Trade (6x9in), Digest (5.5x8.5in), Workbook (8x10in), or a size like 170x240mm or 7x10in")
+
+	orientation := "P"
+	flag.Var(&config.OrientationValue{Orientation: &orientation}, "orientation", "one of L (for landscape), P (for portrait)")
+
+	difficulty := "any"
+	flag.Var(&config.DifficultyValue{Difficulty: &difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+
+	flag.Parse()
+
+	if *format != "png" && *format != "jpeg" {
+		fmt.Println("invalid format, use png or jpeg")
+		os.Exit(2)
+	}
+	if *transparent && (*format == "jpeg" || *background != "") {
+		fmt.Println("a transparent background needs png output and no background image")
+		os.Exit(2)
+	}
+
+	style := rasterStyle{antialias: *antialias, transparent: *transparent, solutions: *solutions}
+	if *background != "" {
+		style.background, err = loadBackground("backgrounds/" + *background)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	sudokus, err := fetchSudokuGames(*dsn, *count, difficulty, *volume)
+	if err != nil {
+		fail(err)
+	}
+	timestamp := time.Now().Format("20060102-150405")
+
+	if *mode == "page" {
+		nx := 1
+		ny := 1
+		if orientation == "L" {
+			nx = 2
+		}
+		if orientation == "P" {
+			ny = 2
+		}
+		fmt.Printf("Rendering %d %s Sudokus in a %d x %d grid at %v dpi\n", len(sudokus), difficulty, nx, ny, *dpi)
+		for page, start := 1, 0; start < len(sudokus); page, start = page+1, start+nx*ny {
+			img, err := drawPage(sudokus, start, nx, ny, paperSize, orientation, difficulty, *dpi, style)
+			if err == nil {
+				err = writeImage(img, filepath.Join(*output, fmt.Sprintf("sudokus-%v-%dx%d-%s-p%d.%s", timestamp, nx, ny, difficulty, page, *format)), *format)
+			}
+			if err != nil {
+				fail(err)
+			}
+		}
+		return
+	}
+
+	fmt.Printf("Rendering %d %s Sudokus at %d x %d pixels\n", len(sudokus), difficulty, *size, *size)
+	for i, sudoku := range sudokus {
+		img, err := drawGridImage(sudoku, *size, style)
+		if err == nil {
+			err = writeImage(img, filepath.Join(*output, fmt.Sprintf("sudoku-%v-%s-%d.%s", timestamp, difficulty, i+1, *format)), *format)
+		}
+		if err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fetchSudokuGames(dsn string, amount int, difficulty string, volume int) ([]Game, error) {
+	puzzles, err := store.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer puzzles.Close()
+
+	// lets fetch
+	offset := 0
+	limit := amount
+
+	if volume > 1 {
+		offset = (volume * 100) + 1
+	}
+
+	listed, err := puzzles.List(difficulty, store.Filter{}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Game, len(listed))
+	for k, p := range listed {
+		results[k] = Game{game: p.Game, solution: p.Solution}
+	}
+	return results, nil
+}
+
+func smaller(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func loadBackground(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrRender, filename, err)
+	}
+	return img, nil
+}
+
+func writeImage(img image.Image, filename string, format string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	defer f.Close()
+
+	if format == "jpeg" {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 92})
+	} else {
+		err = png.Encode(f, img)
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	fmt.Printf("Wrote sudoku image to file %s\n", filename)
+	return nil
+}
+
+// newCanvas returns a w x h image filled according to the style
+func newCanvas(w, h int, style rasterStyle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	switch {
+	case style.transparent:
+		// leave it at the zero value
+	case style.background != nil:
+		xdraw.CatmullRom.Scale(img, img.Bounds(), style.background, style.background.Bounds(), draw.Src, nil)
+	default:
+		draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// ink collects everything drawn in black as a coverage mask, so lines and
+// digits can be thresholded together when anti-aliasing is off
+type ink struct {
+	mask *image.Alpha
+	r    *vector.Rasterizer
+}
+
+func newInk(w, h int) *ink {
+	return &ink{mask: image.NewAlpha(image.Rect(0, 0, w, h)), r: vector.NewRasterizer(w, h)}
+}
+
+func (k *ink) rect(x0, y0, x1, y1 float64) {
+	k.r.Reset(k.mask.Rect.Dx(), k.mask.Rect.Dy())
+	k.r.MoveTo(float32(x0), float32(y0))
+	k.r.LineTo(float32(x1), float32(y0))
+	k.r.LineTo(float32(x1), float32(y1))
+	k.r.LineTo(float32(x0), float32(y1))
+	k.r.ClosePath()
+	k.r.Draw(k.mask, k.mask.Rect, image.Opaque, image.Point{})
+}
+
+// text writes s centered in the w x h box at x, y
+func (k *ink) text(face font.Face, s string, x, y, w, h float64) {
+	d := font.Drawer{Dst: k.mask, Src: image.Opaque, Face: face}
+	width := float64(d.MeasureString(s)) / 64
+	capHeight := float64(face.Metrics().CapHeight) / 64
+	d.Dot = fixed.P(int(x+(w-width)/2+0.5), int(y+(h+capHeight)/2+0.5))
+	d.DrawString(s)
+}
+
+func (k *ink) apply(img *image.RGBA, antialias bool) {
+	if !antialias {
+		for i, a := range k.mask.Pix {
+			if a >= 0x80 {
+				k.mask.Pix[i] = 0xff
+			} else {
+				k.mask.Pix[i] = 0
+			}
+		}
+	}
+	draw.DrawMask(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, k.mask, image.Point{}, draw.Over)
+}
+
+func newFace(ttf []byte, size float64, antialias bool) (font.Face, error) {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	hinting := font.HintingNone
+	if !antialias {
+		hinting = font.HintingFull
+	}
+	// sizes are given in pixels, so render at 72 dpi where 1pt == 1px
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: hinting})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	return face, nil
+}
+
+// drawGrid draws one sudoku of side L at x0, y0 with the same line widths and
+// digit size as the pdf renderers
+func drawGrid(k *ink, face font.Face, cells string, x0, y0, L float64) {
+	fieldL := L / 9
+
+	thinLineWidth := L / 300
+	thickLineWidth := L / 120
+
+	// draw horizontal lines
+	for ly := 0; ly < 10; ly++ {
+		var w float64
+		if ly%3 == 0 {
+			w = thickLineWidth
+		} else {
+			w = thinLineWidth
+		}
+		y := y0 + fieldL*float64(ly)
+		k.rect(x0-w/2, y-w/2, x0+w/2+L, y+w/2)
+	}
+	// draw vertical lines
+	for lx := 0; lx < 10; lx++ {
+		var w float64
+		if lx%3 == 0 {
+			w = thickLineWidth
+		} else {
+			w = thinLineWidth
+		}
+		x := x0 + fieldL*float64(lx)
+		k.rect(x-w/2, y0-w/2, x+w/2, y0+w/2+L)
+	}
+	// draw numbers
+	for i := 0; i < 9; i++ {
+		for j := 0; j < 9; j++ {
+			n := cells[i*9+j]
+			if string(n) != "." {
+				dy := fieldL / 20
+				k.text(face, string(n), x0+fieldL*float64(i), y0+fieldL*float64(j)+dy, fieldL, fieldL)
+			}
+		}
+	}
+}
+
+func drawGridImage(sudoku Game, size int, style rasterStyle) (image.Image, error) {
+	img := newCanvas(size, size, style)
+	k := newInk(size, size)
+
+	pad := float64(size) / 40
+	L := float64(size) - 2*pad
+	face, err := newFace(goregular.TTF, L/9*0.8, style.antialias)
+	if err != nil {
+		return nil, err
+	}
+
+	cells := sudoku.game
+	if style.solutions {
+		cells = sudoku.solution
+	}
+	drawGrid(k, face, cells, pad, pad, L)
+
+	k.apply(img, style.antialias)
+	return img, nil
+}
+
+// drawPage renders a page preview with the generatepdf.go puzzle page layout,
+// converting its mm measurements to pixels at the given dpi
+func drawPage(sudokus []Game, start, nx, ny int, paperSize, orientation, difficulty string, dpi float64, style rasterStyle) (image.Image, error) {
+	// the flag has checked it
+	size, _ := printpdf.PageSize(paperSize)
+	width, height := size[0], size[1]
+	if orientation == "L" {
+		width, height = height, width
+	}
+
+	px := func(mm float64) float64 { return mm / 25.4 * dpi }
+
+	w := int(px(width) + 0.5)
+	h := int(px(height) + 0.5)
+	img := newCanvas(w, h, style)
+	k := newInk(w, h)
+
+	margin := px(6) //6 mm
+
+	drawingWidth := px(width) - 5*margin
+	drawingHeight := px(height) - 6*margin
+
+	offsetY := (px(height) - drawingHeight) / 2
+
+	L := smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
+	fieldL := L / 9
+
+	digits, err := newFace(goregular.TTF, fieldL*0.8, style.antialias)
+	if err != nil {
+		return nil, err
+	}
+	header, err := newFace(gobold.TTF, fieldL*0.7, style.antialias)
+	if err != nil {
+		return nil, err
+	}
+
+	sudokuIndex := start
+	for X := 0; X < nx; X++ {
+		for Y := 0; Y < ny; Y++ {
+			if sudokuIndex >= len(sudokus) {
+				break
+			}
+
+			x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
+			y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
+
+			// write game number on top
+			k.text(header, fmt.Sprintf("Sudoku - %s #%d", strings.Title(difficulty), sudokuIndex+1), x0, y0-2*margin, L, 2*margin)
+
+			cells := sudokus[sudokuIndex].game
+			if style.solutions {
+				cells = sudokus[sudokuIndex].solution
+			}
+			drawGrid(k, digits, cells, x0, y0, L)
+			sudokuIndex++
+		}
+	}
+
+	k.apply(img, style.antialias)
+	return img, nil
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/schokotets/drawsudokus/internal/book"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/printpdf"
+	"github.com/schokotets/drawsudokus/internal/service"
+	"github.com/schokotets/drawsudokus/internal/store"
+)
+
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+)
+
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	if errors.Is(err, ErrStore) {
+		return 5
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	margin, err := strconv.ParseFloat(settings["theme.margin"], 64)
+	if err != nil {
+		fail(fmt.Errorf("theme.margin: %q is not a number", settings["theme.margin"]))
+	}
+	paperSize := "Letter"
+	if value := settings["theme.papersize"]; value != "" {
+		if err := (printpdf.PaperSizeValue{PaperSize: &paperSize}).Set(value); err != nil {
+			fail(fmt.Errorf("theme.papersize: %w", err))
+		}
+	}
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dsn := flag.String("dsn", settings["store.dsn"], "database the pdfs are drawn from, as user:password@tcp(host:port)/dbname")
+	flag.Parse()
+
+	puzzles, err := store.Open(*dsn)
+	if err != nil {
+		fail(err)
+	}
+	defer puzzles.Close()
+
+	// the pdfs of generatepdf.go and mix.go with their default flags
+	options := book.Options{Margin: margin, Font: settings["fonts.family"], Compress: true, Lang: "en-US"}
+
+	log.Printf("Serving sudokus on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, service.New(puzzles, paperSize, options)))
+}
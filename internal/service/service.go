@@ -0,0 +1,281 @@
+// Package service answers the HTTP requests of serve.go. It generates,
+// solves and rates with the package sudoku and draws the layouts of the
+// package book from the store it is given, all in process, so the pdfs
+// look the same as the files of generatepdf.go and mix.go.
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schokotets/drawsudokus/internal/book"
+	"github.com/schokotets/drawsudokus/internal/printpdf"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+// Game is a puzzle and its solution, as /generate and /solve answer
+type Game struct {
+	Game     string `json:"game"`
+	Solution string `json:"solution"`
+}
+
+// Rating is the answer to /rate
+type Rating struct {
+	Difficulty string `json:"difficulty"`
+	Score      int    `json:"score"`
+	Givens     int    `json:"givens"`
+}
+
+// server draws the pdfs from the puzzles of its store with its options,
+// the book on its paper size
+type server struct {
+	puzzles   store.Store
+	paperSize string
+	options   book.Options
+}
+
+// New returns the handler of every endpoint
+func New(puzzles store.Store, paperSize string, options book.Options) http.Handler {
+	s := &server{puzzles: puzzles, paperSize: paperSize, options: options}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate", s.handleGenerate)
+	mux.HandleFunc("/solve", s.handleSolve)
+	mux.HandleFunc("/rate", s.handleRate)
+	mux.HandleFunc("/pdf", s.handlePDF)
+	mux.HandleFunc("/book", s.handleBook)
+	return mux
+}
+
+func validDifficulty(difficulty string) bool {
+	switch difficulty {
+	case "intermediate", "simple", "easy", "expert", "any":
+		return true
+	}
+	return false
+}
+
+// intParam reads a positive integer query parameter of at most max,
+// falling back to def
+func intParam(r *http.Request, name string, def int, max int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	if n > max {
+		return 0, fmt.Errorf("%s must be at most %d", name, max)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// readGrid takes a grid either as the raw request body or as {"game": "..."}
+func readGrid(r *http.Request) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	grid := strings.TrimSpace(string(body))
+	if strings.HasPrefix(grid, "{") {
+		var game Game
+		if err := json.Unmarshal(body, &game); err != nil {
+			return "", err
+		}
+		grid = game.Game
+	}
+
+	cells := make([]byte, 0, 81)
+	for _, c := range grid {
+		switch {
+		case c >= '1' && c <= '9':
+			cells = append(cells, byte(c))
+		case c == '.' || c == '0' || c == '_':
+			cells = append(cells, '.')
+		}
+	}
+	if len(cells) != 81 {
+		return "", fmt.Errorf("expected 81 cells, got %d", len(cells))
+	}
+	return string(cells), nil
+}
+
+// GET /generate?n=10&difficulty=easy
+func (s *server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	n, err := intParam(r, "n", 1, 1000)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	difficulty := strings.ToLower(r.URL.Query().Get("difficulty"))
+	if difficulty == "" {
+		difficulty = "any"
+	}
+	if !validDifficulty(difficulty) {
+		http.Error(w, "invalid difficulty value", http.StatusBadRequest)
+		return
+	}
+
+	// the native generator, stopped when the client goes away
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var games []Game
+	for k := 0; k < n; k++ {
+		puzzle, solution, _, err := sudoku.Generate(r.Context(), rng, difficulty, sudoku.Constraints{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		games = append(games, Game{Game: puzzle.String(), Solution: solution.String()})
+	}
+	writeJSON(w, games)
+}
+
+// POST /solve with the grid as the body
+func (s *server) handleSolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	grid, err := readGrid(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	solution, err := sudoku.SolveUnique(grid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, Game{Game: grid, Solution: solution})
+}
+
+// POST /rate with the grid as the body, answers with the difficulty and
+// score the generator gives it
+func (s *server) handleRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	grid, err := readGrid(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := sudoku.SolveUnique(grid); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	g := sudoku.Parse(grid)
+	rating := sudoku.Rate(g)
+	writeJSON(w, Rating{Difficulty: rating.Difficulty(), Score: rating.Score(), Givens: g.Givens()})
+}
+
+// GET /pdf?difficulty=easy&volume=1&count=100&nx=1&ny=2&papersize=Letter&orientation=P
+func (s *server) handlePDF(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	difficulty := strings.ToLower(q.Get("difficulty"))
+	if difficulty == "" {
+		difficulty = "any"
+	}
+	paperSize := "Letter"
+	if value := q.Get("papersize"); value != "" {
+		if err := (printpdf.PaperSizeValue{PaperSize: &paperSize}).Set(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	orientation := strings.ToUpper(q.Get("orientation"))
+	if orientation == "" {
+		orientation = "P"
+	}
+	if !validDifficulty(difficulty) || (orientation != "L" && orientation != "P") {
+		http.Error(w, "invalid difficulty or orientation", http.StatusBadRequest)
+		return
+	}
+
+	defaultNx, defaultNy := 1, 2
+	if orientation == "L" {
+		defaultNx, defaultNy = 2, 1
+	}
+	volume, err1 := intParam(r, "volume", 1, 10000)
+	count, err2 := intParam(r, "count", 100, 1000)
+	nx, err3 := intParam(r, "nx", defaultNx, 6)
+	ny, err4 := intParam(r, "ny", defaultNy, 6)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sections := []book.Section{{Difficulty: difficulty, Count: count}}
+	sudokus, err := book.Fetch(s.puzzles, volume, sections, []int{book.SheetOffset(volume)}, store.Filter{}, "id", 0)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	data, err := book.Sheets(sudokus[0], nx, ny, volume, difficulty, orientation, paperSize, s.options)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	s.writePDF(w, book.FileName(s.options.Seed, fmt.Sprintf("%dx%d-%s", nx, ny, difficulty)), data)
+}
+
+// GET /book?volume=1 builds the mixed book of mix.go
+func (s *server) handleBook(w http.ResponseWriter, r *http.Request) {
+	volume, err := intParam(r, "volume", 1, 10000)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	spec, err := book.Read("")
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	sudokus, err := book.Fetch(s.puzzles, volume, spec.Sections, book.Offsets(volume, spec.Sections), store.Filter{}, "id", 0)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	data, err := book.Mix(sudokus, spec.Sections, volume, s.paperSize, s.options)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	s.writePDF(w, book.FileName(s.options.Seed, fmt.Sprintf("1x2-mix-vol-%d", volume)), data)
+}
+
+// fail answers 404 for a volume without enough puzzles, and logs anything
+// else as a failure of the server
+func (s *server) fail(w http.ResponseWriter, err error) {
+	if errors.Is(err, book.ErrNotEnoughPuzzles) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("Error: %v", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (s *server) writePDF(w http.ResponseWriter, filename string, data []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.Write(data)
+}
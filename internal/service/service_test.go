@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/schokotets/drawsudokus/internal/book"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+// newServer serves a memory store with amount sudokus in every table,
+// shuffled copies of one seeded puzzle
+func newServer(t *testing.T, amount int) (*httptest.Server, sudoku.Grid, sudoku.Grid) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	puzzle, solution, _, err := sudoku.Generate(context.Background(), rng, "easy", sudoku.Constraints{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	puzzles := store.NewMemory()
+	for _, difficulty := range store.Difficulties {
+		for added := 0; added < amount; {
+			transform := sudoku.RandomTransform(rng)
+			ok, err := puzzles.Add(store.Puzzle{Difficulty: difficulty, Givens: puzzle.Givens(), Game: transform.Apply(puzzle).String(), Solution: transform.Apply(solution).String()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				added++
+			}
+		}
+	}
+	server := httptest.NewServer(New(puzzles, "A5", book.Options{Margin: 6, Font: "Helvetica", Compress: true, Lang: "en-US"}))
+	t.Cleanup(server.Close)
+	return server, puzzle, solution
+}
+
+func get(t *testing.T, server *httptest.Server, path string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	return resp, body.Bytes()
+}
+
+func post(t *testing.T, server *httptest.Server, path, body string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Post(server.URL+path, "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out bytes.Buffer
+	out.ReadFrom(resp.Body)
+	return resp, out.Bytes()
+}
+
+func TestSolveAndRate(t *testing.T) {
+	server, puzzle, solution := newServer(t, 1)
+
+	resp, body := post(t, server, "/solve", `{"game": "`+puzzle.String()+`"}`)
+	var game Game
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &game) != nil || game.Solution != solution.String() {
+		t.Errorf("/solve: %s %s", resp.Status, body)
+	}
+
+	resp, body = post(t, server, "/rate", strings.ReplaceAll(puzzle.String(), ".", "0"))
+	var rating Rating
+	want := sudoku.Rate(puzzle)
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &rating) != nil || rating != (Rating{Difficulty: want.Difficulty(), Score: want.Score(), Givens: puzzle.Givens()}) {
+		t.Errorf("/rate: %s %s", resp.Status, body)
+	}
+
+	for _, c := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/solve", "123", http.StatusBadRequest},
+		{"/rate", `{"game": 1}`, http.StatusBadRequest},
+		{"/solve", solution.String()[:27] + strings.Repeat(".", 54), http.StatusUnprocessableEntity},
+		{"/rate", strings.Repeat("1", 81), http.StatusUnprocessableEntity},
+	} {
+		if resp, body := post(t, server, c.path, c.body); resp.StatusCode != c.status {
+			t.Errorf("%s %q: %s %s, want %d", c.path, c.body, resp.Status, body, c.status)
+		}
+	}
+	if resp, _ := get(t, server, "/solve"); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /solve: %s", resp.Status)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	server, _, _ := newServer(t, 1)
+
+	resp, body := get(t, server, "/generate?n=2&difficulty=simple")
+	var games []Game
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &games) != nil || len(games) != 2 {
+		t.Fatalf("/generate: %s %s", resp.Status, body)
+	}
+	for _, game := range games {
+		if solution, err := sudoku.SolveUnique(game.Game); err != nil || solution != game.Solution {
+			t.Errorf("%s: solved %s, %v, answered %s", game.Game, solution, err, game.Solution)
+		}
+		if label := sudoku.Rate(sudoku.Parse(game.Game)).Difficulty(); label != "simple" {
+			t.Errorf("%s: rated %s", game.Game, label)
+		}
+	}
+
+	for _, path := range []string{"/generate?n=0", "/generate?n=1001", "/generate?difficulty=hard"} {
+		if resp, _ := get(t, server, path); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %s", path, resp.Status)
+		}
+	}
+}
+
+func TestPDF(t *testing.T) {
+	// the default book takes 300 expert sudokus a volume
+	server, _, _ := newServer(t, 300)
+
+	for _, c := range []struct {
+		path     string
+		status   int
+		filename string
+	}{
+		{"/pdf?difficulty=easy&count=6", http.StatusOK, "-1x2-easy.pdf"},
+		{"/pdf?difficulty=expert&count=4&orientation=L&papersize=7x10in", http.StatusOK, "-2x1-expert.pdf"},
+		{"/book", http.StatusOK, "-1x2-mix-vol-1.pdf"},
+		{"/pdf?difficulty=easy&count=100&volume=3", http.StatusNotFound, ""},
+		{"/book?volume=2", http.StatusNotFound, ""},
+		{"/pdf?papersize=B7", http.StatusBadRequest, ""},
+		{"/pdf?orientation=X", http.StatusBadRequest, ""},
+		{"/pdf?nx=7", http.StatusBadRequest, ""},
+		{"/book?volume=x", http.StatusBadRequest, ""},
+	} {
+		resp, body := get(t, server, c.path)
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: %s %.200s, want %d", c.path, resp.Status, body, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		if resp.Header.Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(body, []byte("%PDF-")) {
+			t.Errorf("%s: %s, %.20q is no pdf", c.path, resp.Header.Get("Content-Type"), body)
+		}
+		if disposition := resp.Header.Get("Content-Disposition"); !strings.Contains(disposition, c.filename) {
+			t.Errorf("%s: %s, want a file name ending in %s", c.path, disposition, c.filename)
+		}
+	}
+}
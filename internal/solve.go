@@ -0,0 +1,328 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/store"
+	"github.com/schokotets/drawsudokus/internal/sudoku"
+)
+
+var (
+	// the database can't be reached or read
+	ErrStore = store.ErrStore
+	// the pdf can't be drawn or written
+	ErrRender = errors.New("rendering the pdf")
+)
+
+// exitCode gives every kind of error its own exit status, the same ones
+// generate.go uses
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrStore):
+		return 5
+	case errors.Is(err, ErrRender):
+		return 6
+	}
+	return 1
+}
+
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
+}
+
+func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+	explain := flag.Bool("explain", false, "list every step of a logical solution")
+	format := flag.String("format", "text", "one of text, json")
+	appendix := flag.String("pdf", "", "also write the key steps on annotated grids to this pdf file")
+	id := flag.Int64("id", 0, "solve the sudoku with this id from the database instead of the argument")
+	dsn := flag.String("dsn", settings["store.dsn"], "database of -id, as user:password@tcp(host:port)/dbname")
+
+	difficulty := "any"
+	flag.Var(&config.DifficultyValue{Difficulty: &difficulty}, "difficulty", "table of -id, one of simple, easy, intermediate, expert, any")
+
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		fmt.Println("invalid format, use text or json")
+		os.Exit(2)
+	}
+
+	var puzzle string
+	switch {
+	case *id != 0:
+		puzzle, err = fetchSudokuGame(*dsn, difficulty, *id)
+	case flag.NArg() > 0:
+		puzzle = flag.Arg(0)
+	default:
+		// read it from stdin
+		puzzle, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if puzzle != "" {
+			err = nil
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	g, err := parseGrid(puzzle)
+	if err != nil {
+		fail(err)
+	}
+
+	found, err := sudoku.SolveUnique(g.String())
+	if err != nil {
+		fail(fmt.Errorf("can't solve the sudoku: %w", err))
+	}
+	solution := sudoku.Parse(found)
+
+	steps := sudoku.Explain(g, solution)
+
+	if *format == "json" {
+		out := struct {
+			Puzzle   string        `json:"puzzle"`
+			Solution string        `json:"solution"`
+			Steps    []sudoku.Step `json:"steps,omitempty"`
+		}{Puzzle: g.String(), Solution: solution.String()}
+		if *explain {
+			out.Steps = steps
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+	} else {
+		fmt.Println(solution.String())
+		if *explain {
+			for n, s := range steps {
+				fmt.Printf("%3d. %s: %s\n", n+1, s.Technique, s.Text)
+			}
+		}
+	}
+
+	if *appendix != "" {
+		if err := createPDF(g, steps, *appendix); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fetchSudokuGame(dsn string, difficulty string, id int64) (string, error) {
+	puzzles, err := store.Open(dsn)
+	if err != nil {
+		return "", err
+	}
+	defer puzzles.Close()
+
+	listed, err := puzzles.Between(difficulty, id, id)
+	if err != nil {
+		return "", err
+	}
+	if len(listed) == 0 {
+		return "", fmt.Errorf("no sudoku %d in sudoku_%s", id, difficulty)
+	}
+	// the techniques are those of the classic grid
+	if p := listed[0]; p.Variant != "classic" || p.Size != 9 {
+		return "", fmt.Errorf("sudoku %d in sudoku_%s is a %s sudoku of size %d, only classic 9 x 9 ones are explained", id, difficulty, p.Variant, p.Size)
+	}
+	return listed[0].Game, nil
+}
+
+// parseGrid reads 81 cells, skipping anything that is neither a digit nor
+// an empty cell
+func parseGrid(s string) (sudoku.Grid, error) {
+	var g sudoku.Grid
+	n := 0
+	for _, c := range s {
+		switch {
+		case c >= '1' && c <= '9':
+			if n < 81 {
+				g[n] = int(c - '0')
+			}
+			n++
+		case c == '.' || c == '0' || c == '_':
+			n++
+		}
+	}
+	if n != 81 {
+		return g, fmt.Errorf("expected 81 cells, got %d", n)
+	}
+	return g, nil
+}
+
+func smaller(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// keySteps picks the steps worth a picture: everything beyond singles, or
+// the first few singles when the puzzle needs nothing else
+func keySteps(steps []sudoku.Step) []sudoku.Step {
+	var key []sudoku.Step
+	for _, s := range steps {
+		if s.Technique != sudoku.NakedSingle && s.Technique != sudoku.HiddenSingle {
+			key = append(key, s)
+		}
+	}
+	if len(key) == 0 {
+		key = steps
+		if len(key) > 6 {
+			key = key[:6]
+		}
+	}
+	return key
+}
+
+// createPDF draws the key steps on mini-grids, six to a page: the
+// position before the step, its cells shaded, candidates in grey, removed
+// candidates in red and the placed digit in blue
+func createPDF(puzzle sudoku.Grid, steps []sudoku.Step, filename string) error {
+	pdf := gofpdf.New("P", "mm", "Letter", "")
+	width, height := pdf.GetPageSize()
+	margin := 6. //6 mm
+
+	nx, ny := 2, 3
+
+	drawingWidth := width - 6*margin
+	drawingHeight := height - 8*margin
+
+	offsetY := 4 * margin
+
+	L := smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.75 //small sudoku length
+	fieldL := L / 9
+
+	thinLineWidth := L / 300
+	thickLineWidth := L / 120
+
+	key := keySteps(steps)
+
+	for page := 0; page*nx*ny < len(key); page++ {
+		pdf.AddPage()
+		pdf.SetMargins(0, 0, 0)
+		pdf.SetAutoPageBreak(false, 0)
+		pdf.SetDrawColor(0, 0, 0)
+
+		if page == 0 {
+			pdf.MoveTo(0, margin)
+			pdf.SetFont("Helvetica", "B", 18)
+			pdf.CellFormat(width, 2*margin, "How to solve it", "", 0, "MC", false, 0, "")
+		}
+
+		for Y := 0; Y < ny; Y++ {
+			for X := 0; X < nx; X++ {
+				k := page*nx*ny + Y*nx + X
+				if k >= len(key) {
+					break
+				}
+				s := key[k]
+
+				x0 := 3*margin + float64(X)/float64(nx)*drawingWidth + (drawingWidth/float64(nx)-L)/2
+				y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + margin
+
+				// shade the cells of the step
+				pdf.SetFillColor(220, 230, 245)
+				for _, i := range s.Highlight {
+					pdf.Rect(x0+fieldL*float64(i/9), y0+fieldL*float64(i%9), fieldL, fieldL, "F")
+				}
+
+				// draw horizontal lines
+				for ly := 0; ly < 10; ly++ {
+					var w float64
+					if ly%3 == 0 {
+						w = thickLineWidth
+					} else {
+						w = thinLineWidth
+					}
+					pdf.SetLineWidth(w)
+					pdf.Line(x0-w/2, y0+fieldL*float64(ly), x0+w/2+L, y0+fieldL*float64(ly))
+				}
+				// draw vertical lines
+				for lx := 0; lx < 10; lx++ {
+					var w float64
+					if lx%3 == 0 {
+						w = thickLineWidth
+					} else {
+						w = thinLineWidth
+					}
+					pdf.SetLineWidth(w)
+					pdf.Line(x0+fieldL*float64(lx), y0-w/2, x0+fieldL*float64(lx), y0+w/2+L)
+				}
+
+				// draw numbers and candidates
+				for i := 0; i < 9; i++ {
+					for j := 0; j < 9; j++ {
+						idx := i*9 + j
+						cx, cy := x0+fieldL*float64(i), y0+fieldL*float64(j)
+						if v := s.Before[idx]; v != 0 {
+							pdf.SetFont("Helvetica", "", fieldL*0.8*2.83)
+							if puzzle[idx] != 0 {
+								pdf.SetTextColor(0, 0, 0)
+							} else {
+								pdf.SetTextColor(90, 90, 90)
+							}
+							pdf.MoveTo(cx, cy+fieldL/20)
+							pdf.CellFormat(fieldL, fieldL, fmt.Sprint(v), "", 0, "CM", false, 0, "")
+							continue
+						}
+						if idx == s.PlacedAt {
+							pdf.SetFont("Helvetica", "B", fieldL*0.8*2.83)
+							pdf.SetTextColor(30, 80, 200)
+							pdf.MoveTo(cx, cy+fieldL/20)
+							pdf.CellFormat(fieldL, fieldL, fmt.Sprint(s.Placed.Digit), "", 0, "CM", false, 0, "")
+							continue
+						}
+						pdf.SetFont("Helvetica", "", fieldL*0.28*2.83)
+						for _, v := range sudoku.Digits(s.Candidates[idx]) {
+							if s.Removed[idx]&(1<<v) != 0 {
+								pdf.SetTextColor(210, 30, 30)
+							} else {
+								pdf.SetTextColor(120, 120, 120)
+							}
+							pdf.MoveTo(cx+fieldL/3*float64((v-1)%3), cy+fieldL/3*float64((v-1)/3))
+							pdf.CellFormat(fieldL/3, fieldL/3, fmt.Sprint(v), "", 0, "CM", false, 0, "")
+						}
+					}
+				}
+				pdf.SetTextColor(0, 0, 0)
+
+				// caption
+				pdf.SetFont("Helvetica", "B", 10)
+				pdf.MoveTo(x0, y0+L+1)
+				pdf.CellFormat(L, 5, fmt.Sprintf("Step %d - %s", stepNumber(steps, s), s.Technique), "", 2, "LM", false, 0, "")
+				pdf.SetFont("Helvetica", "", 8)
+				pdf.SetX(x0)
+				pdf.MultiCell(L, 3.5, s.Text, "", "L", false)
+			}
+		}
+	}
+
+	if err := pdf.OutputFileAndClose(filename); err != nil {
+		return fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	// stdout may be json, so talk on stderr
+	fmt.Fprintf(os.Stderr, "Wrote explanation to file %s (%s)\n", filename, time.Now().Format("2006-01-02 15:04"))
+	return nil
+}
+
+func stepNumber(steps []sudoku.Step, s sudoku.Step) int {
+	for n := range steps {
+		if steps[n].Text == s.Text && steps[n].PlacedAt == s.PlacedAt {
+			return n + 1
+		}
+	}
+	return 0
+}
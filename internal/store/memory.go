@@ -0,0 +1,166 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Memory keeps the sudokus for the length of the run, for trying the
+// generator without a database
+type Memory struct {
+	mu           sync.Mutex
+	tables       map[string][]Puzzle
+	games        map[string]bool // difficulty/variant/game/cages of every stored sudoku
+	used         map[Mark]bool   // puzzles in a publication
+	publications []Publication
+}
+
+func NewMemory() *Memory {
+	return &Memory{tables: map[string][]Puzzle{}, games: map[string]bool{}, used: map[Mark]bool{}}
+}
+
+func (s *Memory) Count(difficulty string, filter Filter) (int, error) {
+	if _, err := table(difficulty); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, p := range s.tables[difficulty] {
+		if filter.passes(p) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Memory) Unused(difficulty string, filter Filter) (int, error) {
+	if _, err := table(difficulty); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unused := 0
+	for _, p := range s.tables[difficulty] {
+		if filter.passes(p) && !s.used[Mark{difficulty, p.ID}] {
+			unused++
+		}
+	}
+	return unused, nil
+}
+
+func (s *Memory) Add(p Puzzle) (bool, error) {
+	if _, err := table(p.Difficulty); err != nil {
+		return false, err
+	}
+	p.Variant, p.Size = kind(p.Variant, p.Size)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := p.Difficulty + "/" + p.Variant + "/" + p.Game + "/" + p.Cages
+	if s.games[key] {
+		return false, nil
+	}
+	s.games[key] = true
+	p.ID = int64(len(s.tables[p.Difficulty]) + 1)
+	s.tables[p.Difficulty] = append(s.tables[p.Difficulty], p)
+	return true, nil
+}
+
+func (s *Memory) List(difficulty string, filter Filter, limit, offset int) ([]Puzzle, error) {
+	if _, err := table(difficulty); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var puzzles []Puzzle
+	for _, p := range s.tables[difficulty] {
+		if len(puzzles) == limit {
+			break
+		}
+		if !filter.passes(p) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		puzzles = append(puzzles, p)
+	}
+	return puzzles, nil
+}
+
+func (s *Memory) Between(difficulty string, first, last int64) ([]Puzzle, error) {
+	if _, err := table(difficulty); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var puzzles []Puzzle
+	for _, p := range s.tables[difficulty] {
+		if p.ID >= first && p.ID <= last {
+			puzzles = append(puzzles, p)
+		}
+	}
+	return puzzles, nil
+}
+
+func (s *Memory) Unscored(difficulty string) ([]Puzzle, error) {
+	if _, err := table(difficulty); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var puzzles []Puzzle
+	for _, p := range s.tables[difficulty] {
+		if !p.Score.Valid {
+			puzzles = append(puzzles, p)
+		}
+	}
+	return puzzles, nil
+}
+
+func (s *Memory) SetScore(difficulty string, id int64, score int64) error {
+	if _, err := table(difficulty); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > int64(len(s.tables[difficulty])) {
+		return fmt.Errorf("%w: scoring sudoku_%s: no sudoku %d", ErrStore, difficulty, id)
+	}
+	p := &s.tables[difficulty][id-1]
+	p.Score.Int64, p.Score.Valid = score, true
+	return nil
+}
+
+func (s *Memory) Publish(pub Publication) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range pub.Puzzles {
+		if _, err := table(m.Difficulty); err != nil {
+			return 0, err
+		}
+		if m.ID < 1 || m.ID > int64(len(s.tables[m.Difficulty])) {
+			return 0, fmt.Errorf("%w: publishing %s: sudoku_%s has no sudoku %d", ErrStore, pub.File, m.Difficulty, m.ID)
+		}
+	}
+	for _, m := range pub.Puzzles {
+		s.used[m] = true
+	}
+	pub.ID = int64(len(s.publications) + 1)
+	pub.Created = pub.Created.Truncate(time.Second)
+	pub.Puzzles = append([]Mark(nil), pub.Puzzles...)
+	s.publications = append(s.publications, pub)
+	return pub.ID, nil
+}
+
+func (s *Memory) Publications() ([]Publication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Publication(nil), s.publications...), nil
+}
+
+func (s *Memory) Close() error {
+	return nil
+}
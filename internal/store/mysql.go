@@ -0,0 +1,267 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Querier is what MySQL needs of a connection, a *sql.DB or a *sql.Tx
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// MySQL keeps the sudokus in the sudoku_<difficulty> tables and the ledger
+// in publication and publication_sudoku, see the README for the schema
+type MySQL struct {
+	db Querier
+}
+
+func NewMySQL(db Querier) *MySQL {
+	return &MySQL{db}
+}
+
+func (s *MySQL) Count(difficulty string, filter Filter) (int, error) {
+	name, err := table(difficulty)
+	if err != nil {
+		return 0, err
+	}
+	where, args := filter.where()
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM "+name+" WHERE "+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("%w: counting %s: %w", ErrStore, name, err)
+	}
+	return count, nil
+}
+
+func (s *MySQL) Unused(difficulty string, filter Filter) (int, error) {
+	name, err := table(difficulty)
+	if err != nil {
+		return 0, err
+	}
+	where, args := filter.where()
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM "+name+" WHERE "+where+" AND id NOT IN (SELECT sudoku_id FROM publication_sudoku WHERE difficulty = ?)", append(args, difficulty)...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%w: counting the unused sudokus of %s: %w", ErrStore, name, err)
+	}
+	return count, nil
+}
+
+func (s *MySQL) Add(p Puzzle) (bool, error) {
+	name, err := table(p.Difficulty)
+	if err != nil {
+		return false, err
+	}
+
+	// check if value already exists
+	p.Variant, p.Size = kind(p.Variant, p.Size)
+	var id int64
+	err = s.db.QueryRow("SELECT id FROM "+name+" WHERE game=? AND variant=? AND COALESCE(cages, '')=?", p.Game, p.Variant, p.Cages).Scan(&id)
+	if err == nil {
+		return false, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, fmt.Errorf("%w: looking up a sudoku in %s: %w", ErrStore, name, err)
+	}
+
+	// means there's no previous record
+	source := sql.NullString{String: p.Source, Valid: p.Source != ""}
+	cages := sql.NullString{String: p.Cages, Valid: p.Cages != ""}
+	_, err = s.db.Exec("INSERT INTO "+name+"(game, solution, variant, size, cages, symmetry, givens, score, source) VALUE(?, ?, ?, ?, ?, ?, ?, ?, ?);", p.Game, p.Solution, p.Variant, p.Size, cages, p.Symmetry, p.Givens, p.Score, source)
+	if err != nil {
+		return false, fmt.Errorf("%w: inserting into %s: %w", ErrStore, name, err)
+	}
+	return true, nil
+}
+
+func (s *MySQL) List(difficulty string, filter Filter, limit, offset int) ([]Puzzle, error) {
+	if _, err := table(difficulty); err != nil {
+		return nil, err
+	}
+
+	where, args := filter.where()
+	return s.read(difficulty, " WHERE "+where+" ORDER BY id LIMIT ? OFFSET ?", append(args, limit, offset)...)
+}
+
+// where is the condition of the puzzles the filter picks
+func (f Filter) where() (string, []any) {
+	variant, size := kind(f.Variant, f.Size)
+	conditions := []string{"variant = ?", "size = ?"}
+	args := []any{variant, size}
+	if f.Symmetry != "" && f.Symmetry != "any" {
+		conditions = append(conditions, "symmetry = ?")
+		args = append(args, f.Symmetry)
+	}
+	if f.MinGivens > 0 {
+		conditions = append(conditions, "givens >= ?")
+		args = append(args, f.MinGivens)
+	}
+	if f.MaxGivens > 0 {
+		conditions = append(conditions, "givens <= ?")
+		args = append(args, f.MaxGivens)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (s *MySQL) Between(difficulty string, first, last int64) ([]Puzzle, error) {
+	if _, err := table(difficulty); err != nil {
+		return nil, err
+	}
+	return s.read(difficulty, " WHERE id BETWEEN ? AND ? ORDER BY id", first, last)
+}
+
+func (s *MySQL) Unscored(difficulty string) ([]Puzzle, error) {
+	if _, err := table(difficulty); err != nil {
+		return nil, err
+	}
+	return s.read(difficulty, " WHERE score IS NULL ORDER BY id")
+}
+
+// read returns the puzzles a query of the difficulty's table picks
+func (s *MySQL) read(difficulty string, query string, args ...any) ([]Puzzle, error) {
+	name := "sudoku_" + difficulty
+	read, err := s.db.Query("SELECT id, game, solution, variant, size, cages, symmetry, givens, score, source FROM "+name+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading %s: %w", ErrStore, name, err)
+	}
+	defer read.Close()
+
+	var puzzles []Puzzle
+	for read.Next() {
+		p := Puzzle{Difficulty: difficulty}
+		var givens sql.NullInt64
+		var cages, source sql.NullString
+		if err := read.Scan(&p.ID, &p.Game, &p.Solution, &p.Variant, &p.Size, &cages, &p.Symmetry, &givens, &p.Score, &source); err != nil {
+			return nil, fmt.Errorf("%w: reading %s: %w", ErrStore, name, err)
+		}
+		p.Givens, p.Cages, p.Source = int(givens.Int64), cages.String, source.String
+		if !givens.Valid {
+			p.Givens = 81 - strings.Count(p.Game, ".")
+		}
+		puzzles = append(puzzles, p)
+	}
+	if err := read.Err(); err != nil {
+		return nil, fmt.Errorf("%w: reading %s: %w", ErrStore, name, err)
+	}
+	return puzzles, nil
+}
+
+func (s *MySQL) SetScore(difficulty string, id int64, score int64) error {
+	name, err := table(difficulty)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec("UPDATE "+name+" SET score = ? WHERE id = ?", score, id); err != nil {
+		return fmt.Errorf("%w: scoring %s: %w", ErrStore, name, err)
+	}
+	return nil
+}
+
+func (s *MySQL) Publish(pub Publication) (int64, error) {
+	// all of the publication or none of it, in a transaction of its own
+	// unless the store already runs in one
+	q := s.db
+	commit := func() error { return nil }
+	if db, ok := s.db.(*sql.DB); ok {
+		tx, err := db.Begin()
+		if err != nil {
+			return 0, fmt.Errorf("%w: publishing %s: %w", ErrStore, pub.File, err)
+		}
+		defer tx.Rollback()
+		q, commit = tx, tx.Commit
+	}
+
+	for _, m := range pub.Puzzles {
+		name, err := table(m.Difficulty)
+		if err != nil {
+			return 0, err
+		}
+		var id int64
+		err = q.QueryRow("SELECT id FROM "+name+" WHERE id = ?", m.ID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("%w: publishing %s: %s has no sudoku %d", ErrStore, pub.File, name, m.ID)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: publishing %s: %w", ErrStore, pub.File, err)
+		}
+	}
+
+	result, err := q.Exec("INSERT INTO publication(program, name, volume, seed, file, created) VALUE(?, ?, ?, ?, ?, ?);", pub.Program, pub.Name, pub.Volume, pub.Seed, pub.File, pub.Created.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%w: publishing %s: %w", ErrStore, pub.File, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%w: publishing %s: %w", ErrStore, pub.File, err)
+	}
+	for k, m := range pub.Puzzles {
+		_, err := q.Exec("INSERT INTO publication_sudoku(publication_id, position, difficulty, sudoku_id) VALUE(?, ?, ?, ?);", id, k, m.Difficulty, m.ID)
+		if err != nil {
+			return 0, fmt.Errorf("%w: publishing %s: %w", ErrStore, pub.File, err)
+		}
+	}
+
+	if err := commit(); err != nil {
+		return 0, fmt.Errorf("%w: publishing %s: %w", ErrStore, pub.File, err)
+	}
+	return id, nil
+}
+
+func (s *MySQL) Publications() ([]Publication, error) {
+	read, err := s.db.Query("SELECT id, program, name, volume, seed, file, created FROM publication ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the ledger: %w", ErrStore, err)
+	}
+	var pubs []Publication
+	for read.Next() {
+		var pub Publication
+		var created int64
+		if err := read.Scan(&pub.ID, &pub.Program, &pub.Name, &pub.Volume, &pub.Seed, &pub.File, &created); err != nil {
+			read.Close()
+			return nil, fmt.Errorf("%w: reading the ledger: %w", ErrStore, err)
+		}
+		pub.Created = time.Unix(created, 0)
+		pubs = append(pubs, pub)
+	}
+	err = read.Err()
+	read.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the ledger: %w", ErrStore, err)
+	}
+
+	for k := range pubs {
+		read, err := s.db.Query("SELECT difficulty, sudoku_id FROM publication_sudoku WHERE publication_id = ? ORDER BY position", pubs[k].ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading the ledger: %w", ErrStore, err)
+		}
+		for read.Next() {
+			var m Mark
+			if err := read.Scan(&m.Difficulty, &m.ID); err != nil {
+				read.Close()
+				return nil, fmt.Errorf("%w: reading the ledger: %w", ErrStore, err)
+			}
+			pubs[k].Puzzles = append(pubs[k].Puzzles, m)
+		}
+		err = read.Err()
+		read.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading the ledger: %w", ErrStore, err)
+		}
+	}
+	return pubs, nil
+}
+
+// Close closes the database, a transaction is left to its owner
+func (s *MySQL) Close() error {
+	if c, ok := s.db.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package store keeps the sudokus the programs in internal generate, import
+// and print, in MySQL or, for trying things out, in memory. Both answer to
+// the same conformance tests, see store_test.go.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStore is wrapped by every error of a store: the database can't be
+// reached, read or written
+var ErrStore = errors.New("sudoku store")
+
+// Difficulties are the tables, one per difficulty
+var Difficulties = []string{"simple", "easy", "intermediate", "expert", "any"}
+
+// Puzzle is a stored sudoku. Symmetry and Score are null for puzzles stored
+// before they were kept, or imported. Variant and Size are those of
+// sudoku.NewShape, a puzzle without them is a classic 9 x 9 one.
+type Puzzle struct {
+	ID         int64 // set by the store, in the order puzzles were added
+	Difficulty string
+	Variant    string
+	Size       int
+	Cages      string // a killer's, as sudoku.FormatCages writes them
+	Symmetry   sql.NullString
+	Givens     int
+	Score      sql.NullInt64
+	Game       string
+	Solution   string
+	Source     string
+}
+
+// Filter picks the puzzles a book may use. It only ever picks one variant
+// and size, classic 9 x 9 when they are not set.
+type Filter struct {
+	Variant   string
+	Size      int
+	Symmetry  string // "" or any for every symmetry
+	MinGivens int
+	MaxGivens int // 0 for no limit
+}
+
+// Mark names a puzzle of a publication
+type Mark struct {
+	Difficulty string
+	ID         int64
+}
+
+// Publication is an entry of the ledger: a file that was published, how to
+// make it again, and the puzzles in it, in the order they are printed
+type Publication struct {
+	ID      int64 // set by the store
+	Program string
+	Name    string // the book or layout
+	Volume  int
+	Seed    int64 // 0 for an unseeded file
+	File    string
+	Created time.Time // kept to the second
+	Puzzles []Mark
+}
+
+// Store is where the sudokus go. Puzzles come back in the order they were
+// added, a table never holds the same game twice, and a puzzle stays unused
+// until a publication marks it.
+type Store interface {
+	// Count returns the number of sudokus of the difficulty that pass the
+	// filter
+	Count(difficulty string, filter Filter) (int, error)
+	// Unused returns the number of sudokus of the difficulty that pass the
+	// filter and are in no publication
+	Unused(difficulty string, filter Filter) (int, error)
+	// Add stores the puzzle unless its table already has the game of its
+	// variant with the same cages, and reports whether it did
+	Add(p Puzzle) (bool, error)
+	// List returns the sudokus of the difficulty that pass the filter, in
+	// the order they were added, skipping the first offset of them
+	List(difficulty string, filter Filter, limit, offset int) ([]Puzzle, error)
+	// Between returns the sudokus of the difficulty with an id from first
+	// to last, in order of id, whatever their variant
+	Between(difficulty string, first, last int64) ([]Puzzle, error)
+	// Unscored returns the sudokus of the difficulty without a score
+	Unscored(difficulty string) ([]Puzzle, error)
+	// SetScore rates a stored sudoku
+	SetScore(difficulty string, id int64, score int64) error
+	// Publish adds the publication to the ledger, marking its puzzles as
+	// used, and returns its id. Every puzzle has to be stored; a puzzle
+	// may be in several publications.
+	Publish(pub Publication) (int64, error)
+	// Publications returns the ledger, oldest first
+	Publications() ([]Publication, error)
+	Close() error
+}
+
+// Open returns the store a -dsn flag names: memory, or a MySQL data source
+// like user:password@tcp(host:port)/dbname
+func Open(dsn string) (Store, error) {
+	if dsn == "memory" {
+		return NewMemory(), nil
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStore, err)
+	}
+	return NewMySQL(db), nil
+}
+
+// table checks the difficulty, which names a table
+func table(difficulty string) (string, error) {
+	for _, d := range Difficulties {
+		if d == difficulty {
+			return "sudoku_" + difficulty, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no table for difficulty %q", ErrStore, difficulty)
+}
+
+// kind is the variant and size of a puzzle or a filter, classic 9 x 9 when
+// they are not set
+func kind(variant string, size int) (string, int) {
+	if variant == "" {
+		variant = "classic"
+	}
+	if size == 0 {
+		size = 9
+	}
+	return variant, size
+}
+
+// passes tells whether the puzzle is one the filter picks
+func (f Filter) passes(p Puzzle) bool {
+	variant, size := kind(f.Variant, f.Size)
+	if p.Variant != variant || p.Size != size {
+		return false
+	}
+	if f.Symmetry != "" && f.Symmetry != "any" && (!p.Symmetry.Valid || p.Symmetry.String != f.Symmetry) {
+		return false
+	}
+	return p.Givens >= f.MinGivens && (f.MaxGivens == 0 || p.Givens <= f.MaxGivens)
+}
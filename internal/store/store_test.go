@@ -0,0 +1,326 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	conformance(t, NewMemory())
+}
+
+// TestMySQL runs the same checks on the database DRAWSUDOKU_TEST_DSN names,
+// which needs the tables of the README. Everything happens in a transaction
+// that is rolled back, so the tables are left as they were.
+func TestMySQL(t *testing.T) {
+	dsn := os.Getenv("DRAWSUDOKU_TEST_DSN")
+	if dsn == "" {
+		t.Skip("DRAWSUDOKU_TEST_DSN is not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	conformance(t, NewMySQL(tx))
+}
+
+// conformance checks what every store has to do. A database may hold other
+// sudokus already, so the checks only look at the ones they add.
+func conformance(t *testing.T, s Store) {
+	// a fixed seed, so a failure comes back on the next run
+	rng := rand.New(rand.NewSource(1))
+	newPuzzle := func(difficulty string, symmetry string, givens int) Puzzle {
+		game := make([]byte, 81)
+		for i := range game {
+			game[i] = "123456789"[rng.Intn(9)]
+		}
+		for _, i := range rng.Perm(81)[:81-givens] {
+			game[i] = '.'
+		}
+		p := Puzzle{Difficulty: difficulty, Variant: "classic", Size: 9, Givens: givens, Game: string(game), Solution: string(game), Source: "conformance"}
+		if symmetry != "" {
+			p.Symmetry = sql.NullString{String: symmetry, Valid: true}
+		}
+		p.Score = sql.NullInt64{Int64: int64(rng.Intn(1000)), Valid: true}
+		return p
+	}
+	// listAll returns the sudokus of the difficulty the filter picks that
+	// are among the games
+	listAll := func(difficulty string, filter Filter, games []Puzzle) []Puzzle {
+		t.Helper()
+		ours := map[string]bool{}
+		for _, p := range games {
+			ours[p.Game] = true
+		}
+		all, err := s.List(difficulty, filter, 1<<30, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var listed []Puzzle
+		for _, p := range all {
+			if ours[p.Game] {
+				listed = append(listed, p)
+			}
+		}
+		return listed
+	}
+	count := func(difficulty string) (int, int) {
+		t.Helper()
+		total, err := s.Count(difficulty, Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		unused, err := s.Unused(difficulty, Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return total, unused
+	}
+
+	beforeTotal, beforeUnused := count("easy")
+	games := []Puzzle{newPuzzle("easy", "rotate180", 30), newPuzzle("easy", "none", 25), newPuzzle("easy", "", 36), newPuzzle("easy", "rotate180", 22)}
+	games[2].Score = sql.NullInt64{}
+	games[2].Source = ""
+	for k, p := range games {
+		if isNew, err := s.Add(p); err != nil || !isNew {
+			t.Fatalf("new sudoku %d was not stored: %v", k+1, err)
+		}
+	}
+
+	t.Run("count", func(t *testing.T) {
+		if total, unused := count("easy"); total != beforeTotal+len(games) || unused != beforeUnused+len(games) {
+			t.Errorf("%d sudokus, %d unused after storing %d, %d and %d before", total, unused, len(games), beforeTotal, beforeUnused)
+		}
+	})
+
+	t.Run("unique", func(t *testing.T) {
+		if isNew, err := s.Add(games[1]); err != nil || isNew {
+			t.Errorf("a sudoku already in the table was stored again: %v", err)
+		}
+		if total, _ := count("easy"); total != beforeTotal+len(games) {
+			t.Errorf("storing a duplicate changed the count to %d", total)
+		}
+		other := games[0]
+		other.Difficulty = "expert"
+		if isNew, err := s.Add(other); err != nil || !isNew {
+			t.Errorf("a sudoku of another table was not stored: %v", err)
+		}
+	})
+
+	t.Run("order", func(t *testing.T) {
+		listed := listAll("easy", Filter{}, games)
+		if len(listed) != len(games) {
+			t.Fatalf("listed %d of the %d stored sudokus", len(listed), len(games))
+		}
+		for k := range games {
+			want := games[k]
+			want.ID = listed[k].ID
+			if listed[k] != want {
+				t.Errorf("sudoku %d came back as %+v, stored %+v", k+1, listed[k], games[k])
+			}
+			if k > 0 && listed[k].ID <= listed[k-1].ID {
+				t.Errorf("sudoku %d has id %d after %d", k+1, listed[k].ID, listed[k-1].ID)
+			}
+		}
+	})
+
+	t.Run("between", func(t *testing.T) {
+		listed := listAll("easy", Filter{}, games)
+		between, err := s.Between("easy", listed[1].ID, listed[2].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(between) != 2 || between[0] != listed[1] || between[1] != listed[2] {
+			t.Errorf("ids %d to %d gave %+v", listed[1].ID, listed[2].ID, between)
+		}
+		if none, err := s.Between("easy", listed[3].ID+1000000, listed[3].ID+1000001); err != nil || len(none) != 0 {
+			t.Errorf("ids past the table gave %d sudokus: %v", len(none), err)
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		for _, c := range []struct {
+			filter Filter
+			want   []int
+		}{
+			{Filter{Symmetry: "rotate180"}, []int{0, 3}},
+			{Filter{Symmetry: "any", MinGivens: 25}, []int{0, 1, 2}},
+			{Filter{MaxGivens: 25}, []int{1, 3}},
+			{Filter{Symmetry: "rotate180", MinGivens: 23, MaxGivens: 30}, []int{0}},
+		} {
+			listed := listAll("easy", c.filter, games)
+			var got []int
+			for _, p := range listed {
+				for k := range games {
+					if p.Game == games[k].Game {
+						got = append(got, k)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%+v picked sudokus %v, want %v", c.filter, got, c.want)
+			}
+		}
+
+		// the offset counts the sudokus the filter picks
+		filter := Filter{Symmetry: "rotate180"}
+		all, err := s.List("easy", filter, 1<<30, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tail, err := s.List("easy", filter, 2, len(all)-2)
+		if err != nil || !reflect.DeepEqual(tail, all[len(all)-2:]) {
+			t.Errorf("the last two of %d sudokus came back as %+v, %v", len(all), tail, err)
+		}
+	})
+
+	t.Run("score", func(t *testing.T) {
+		unscored, err := s.Unscored("easy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var id int64
+		for _, p := range unscored {
+			if p.Score.Valid {
+				t.Errorf("sudoku %d has a score but is unscored", p.ID)
+			}
+			if p.Game == games[2].Game {
+				id = p.ID
+			}
+		}
+		if id == 0 {
+			t.Fatalf("the sudoku without a score is not unscored")
+		}
+		if err := s.SetScore("easy", id, 77); err != nil {
+			t.Fatal(err)
+		}
+		if listed := listAll("easy", Filter{}, games[2:3]); len(listed) != 1 || listed[0].Score != (sql.NullInt64{Int64: 77, Valid: true}) {
+			t.Errorf("scored as %+v", listed)
+		}
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		listed := listAll("easy", Filter{}, games)
+		before, err := s.Publications()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, unused := count("easy")
+
+		pub := Publication{Program: "mix.go", Name: "conformance", Volume: 3, Seed: 1234, File: "sudokus/conformance.pdf", Created: time.Unix(1700000000, 0),
+			Puzzles: []Mark{{"easy", listed[2].ID}, {"easy", listed[0].ID}}}
+		id, err := s.Publish(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total, after := count("easy"); total != beforeTotal+len(games) || after != unused-2 {
+			t.Errorf("%d sudokus, %d unused after publishing 2 of %d unused", total, after, unused)
+		}
+
+		// a rebuilt volume is a publication of its own, but uses nothing new
+		again := pub
+		again.Puzzles = []Mark{{"easy", listed[0].ID}}
+		if _, err := s.Publish(again); err != nil {
+			t.Fatal(err)
+		}
+		if _, after := count("easy"); after != unused-2 {
+			t.Errorf("%d unused after publishing a used sudoku again, %d before", after, unused-2)
+		}
+
+		pubs, err := s.Publications()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pubs) != len(before)+2 {
+			t.Fatalf("the ledger has %d publications, %d before publishing 2", len(pubs), len(before))
+		}
+		got := pubs[len(before)]
+		want := pub
+		want.ID = id
+		if !got.Created.Equal(want.Created) {
+			t.Errorf("published at %v, came back as %v", want.Created, got.Created)
+		}
+		got.Created = want.Created
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("the publication came back as %+v, published %+v", got, want)
+		}
+
+		// all of a publication or nothing
+		missing := pub
+		missing.Puzzles = []Mark{{"easy", listed[1].ID}, {"easy", listed[3].ID + 1<<40}}
+		if _, err := s.Publish(missing); !errors.Is(err, ErrStore) {
+			t.Errorf("publishing a sudoku that is not stored gave %v", err)
+		}
+		if _, after := count("easy"); after != unused-2 {
+			t.Errorf("a failed publication left %d unused, %d before", after, unused-2)
+		}
+		if pubs, err := s.Publications(); err != nil || len(pubs) != len(before)+2 {
+			t.Errorf("a failed publication is in the ledger: %d publications, %v", len(pubs), err)
+		}
+	})
+
+	t.Run("variants", func(t *testing.T) {
+		// a killer with the same givens as a classic sudoku, another with
+		// other cages and a 6 x 6 one, none of which the classic books see
+		killer := newPuzzle("easy", "", 0)
+		killer.Variant, killer.Cages = "killer", "10:0,1,9;7:2"
+		killer.Game = strings.Repeat(".", 81)
+		recut := killer
+		recut.Cages = "10:0,1;7:2,9"
+		small := newPuzzle("easy", "", 0)
+		small.Variant, small.Size, small.Game, small.Solution = "", 6, "12....34..........................56", "123456345612561234214365436521652143"
+		var kinds []Puzzle
+		for k, p := range []Puzzle{killer, recut, small} {
+			if isNew, err := s.Add(p); err != nil || !isNew {
+				t.Fatalf("variant %d was not stored: %v", k+1, err)
+			}
+			kinds = append(kinds, p)
+		}
+		if isNew, err := s.Add(recut); err != nil || isNew {
+			t.Errorf("a killer already in the table was stored again: %v", err)
+		}
+
+		if total, _ := count("easy"); total != beforeTotal+len(games) {
+			t.Errorf("%d classic sudokus after storing other variants, %d before", total, beforeTotal+len(games))
+		}
+		if listed := listAll("easy", Filter{}, kinds); len(listed) != 0 {
+			t.Errorf("the classic filter picked %+v", listed)
+		}
+		killers := listAll("easy", Filter{Variant: "killer"}, kinds)
+		if len(killers) != 2 || killers[0].Cages != killer.Cages || killers[1].Cages != recut.Cages || killers[0].Size != 9 {
+			t.Errorf("the killers came back as %+v", killers)
+		}
+		smalls := listAll("easy", Filter{Size: 6}, kinds)
+		if len(smalls) != 1 || smalls[0].Variant != "classic" || smalls[0].Size != 6 || smalls[0].Solution != small.Solution {
+			t.Errorf("the 6 x 6 sudokus came back as %+v", smalls)
+		}
+		if n, err := s.Unused("easy", Filter{Variant: "killer"}); err != nil || n < 2 {
+			t.Errorf("%d unused killers, %v", n, err)
+		}
+		between, err := s.Between("easy", killers[0].ID, smalls[0].ID)
+		if err != nil || len(between) != 3 {
+			t.Errorf("ids %d to %d gave %d sudokus of every variant, %v", killers[0].ID, smalls[0].ID, len(between), err)
+		}
+	})
+
+	t.Run("difficulty", func(t *testing.T) {
+		if _, err := s.Count("easy; DROP TABLE sudoku_easy", Filter{}); !errors.Is(err, ErrStore) {
+			t.Errorf("an unknown difficulty gave %v", err)
+		}
+		if _, err := s.Add(Puzzle{Difficulty: "killer"}); !errors.Is(err, ErrStore) {
+			t.Errorf("an unknown difficulty gave %v", err)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package sudoku
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Step is one step of a logical solution. Cells are named the way they
+// appear in the books, which draw game[i*9+j] in column i, row j.
+type Step struct {
+	Technique  string        `json:"technique"`
+	Cells      []string      `json:"cells"`
+	Placed     *Placement    `json:"placed,omitempty"`
+	Eliminated []Elimination `json:"eliminated,omitempty"`
+	Text       string        `json:"text"`
+
+	// the position before the step and the cells it is about, for drawing
+	// it: the candidates of every cell, the cells it highlights, the
+	// candidates it removes and the cell it fills or -1
+	Before     Grid           `json:"-"`
+	Candidates [81]uint16     `json:"-"`
+	Highlight  []int          `json:"-"`
+	Removed    map[int]uint16 `json:"-"`
+	PlacedAt   int            `json:"-"`
+}
+
+// Placement is the digit a step puts in a cell
+type Placement struct {
+	Cell  string `json:"cell"`
+	Digit int    `json:"digit"`
+}
+
+// Elimination is the candidates a step removes from a cell
+type Elimination struct {
+	Cell   string `json:"cell"`
+	Digits []int  `json:"digits"`
+}
+
+// Explain solves the puzzle the way a person would, with the techniques
+// and in the order Rate uses. When nothing works it places the solution's
+// digit in the cell with the fewest candidates and calls that a guess.
+func Explain(puzzle, solution Grid) []Step {
+	g := puzzle
+	cands := candidateGrid(g)
+	var steps []Step
+	for {
+		s := Step{Before: g, Candidates: cands}
+		d, ok := deduce(&g, &cands)
+		if !ok {
+			// guess: the cell with the fewest candidates gets the solution's digit
+			best, bestCount := -1, 10
+			for i := 0; i < 81; i++ {
+				if g[i] == 0 && bitCount(cands[i]) < bestCount {
+					best, bestCount = i, bitCount(cands[i])
+				}
+			}
+			if best < 0 {
+				return steps
+			}
+			v := solution[best]
+			place(&g, &cands, best, v)
+			d = deduction{technique: Guess, cells: []int{best}, digits: []int{v}, placed: best}
+		}
+
+		s.Technique = d.technique
+		s.Highlight = d.cells
+		for _, i := range d.cells {
+			s.Cells = append(s.Cells, cellName(i))
+		}
+		s.PlacedAt = d.placed
+		if d.placed >= 0 {
+			s.Placed = &Placement{Cell: cellName(d.placed), Digit: d.digits[0]}
+		}
+		for _, r := range d.removed {
+			if s.Removed == nil {
+				s.Removed = map[int]uint16{}
+			}
+			s.Removed[r.cell] |= r.bits
+			s.Eliminated = append(s.Eliminated, Elimination{Cell: cellName(r.cell), Digits: Digits(r.bits)})
+		}
+		s.Text = d.text(s.Candidates)
+		if len(s.Eliminated) > 0 {
+			var parts []string
+			for _, e := range s.Eliminated {
+				parts = append(parts, fmt.Sprintf("%v from %s", joinDigits(e.Digits), e.Cell))
+			}
+			s.Text += ", removing " + strings.Join(parts, ", ")
+		}
+		steps = append(steps, s)
+	}
+}
+
+// text says what the step found, given the candidates before it
+func (d deduction) text(cands [81]uint16) string {
+	v := d.digits[0]
+	switch d.technique {
+	case NakedSingle:
+		return fmt.Sprintf("%s can only be %d", cellName(d.placed), v)
+	case HiddenSingle:
+		return fmt.Sprintf("%s is the only place for %d in %s", cellName(d.placed), v, unitName(d.unit))
+	case Pointing:
+		return fmt.Sprintf("in %s, %d can only go in %s, so it can't go anywhere else in %s", unitName(d.box), v, unitName(d.unit), unitName(d.unit))
+	case BoxLine:
+		return fmt.Sprintf("in %s, %d can only go in %s, so it can't go anywhere else in %s", unitName(d.unit), v, unitName(d.box), unitName(d.box))
+	case NakedPair:
+		return fmt.Sprintf("%s and %s in %s can only hold %s", cellName(d.cells[0]), cellName(d.cells[1]), unitName(d.unit), joinDigits(d.digits))
+	case HiddenPair:
+		return fmt.Sprintf("%d and %d only fit %s and %s in %s", v, d.digits[1], cellName(d.cells[0]), cellName(d.cells[1]), unitName(d.unit))
+	}
+	return fmt.Sprintf("no technique applies, trying %d of %s in %s leads to the solution", v, joinDigits(Digits(cands[d.placed])), cellName(d.placed))
+}
+
+// cellName names cell i as it is printed: column i/9, row i%9
+func cellName(i int) string {
+	return fmt.Sprintf("r%dc%d", i%9+1, i/9+1)
+}
+
+// unitName names a unit as it is printed, where qqwing's rows are columns
+func unitName(u int) string {
+	switch {
+	case u < 9:
+		return fmt.Sprintf("column %d", u+1)
+	case u < 18:
+		return fmt.Sprintf("row %d", u-8)
+	}
+	b := u - 18
+	return fmt.Sprintf("box %d", (b%3)*3+b/3+1)
+}
+
+func joinDigits(ds []int) string {
+	parts := make([]string, len(ds))
+	for i, d := range ds {
+		parts[i] = fmt.Sprint(d)
+	}
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
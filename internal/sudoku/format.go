@@ -0,0 +1,346 @@
+package sudoku
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Formats lists what ReadPuzzles reads: qqwing one-line files, SudoCue
+// .sdm, SadMan .sdk, Simple Sudoku .ss, text grids, .csv, and the json and
+// ipuz files WriteExport writes
+var Formats = []string{"oneline", "sdm", "sdk", "ss", "grid", "csv", "json", "ipuz"}
+
+// ReadPuzzles reads the puzzles of a file in the format, in qqwing's
+// one-line notation. Only the givens are read, solutions are found again.
+func ReadPuzzles(r io.Reader, format string) ([]string, error) {
+	switch format {
+	case "oneline", "sdm":
+		return parseLines(r)
+	case "sdk":
+		return parseSadMan(r)
+	case "ss", "grid":
+		return parseGrid(r)
+	case "csv":
+		return parseCSV(r)
+	case "json":
+		return parseJSON(r)
+	case "ipuz":
+		return parseIPUZ(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// cellValue maps the characters used for cells by the supported formats to
+// qqwing's notation, '.' for an empty cell and '1'-'9' for a given
+func cellValue(c rune) (byte, bool) {
+	switch {
+	case c >= '1' && c <= '9':
+		return byte(c), true
+	case c == '.' || c == '0' || c == '_' || c == '-' || c == 'x' || c == 'X' || c == '*':
+		return '.', true
+	}
+	return 0, false
+}
+
+// oneLine reads 81 cells written in any of the notations of cellValue
+func oneLine(text string) (string, error) {
+	if len(text) != 81 {
+		return "", fmt.Errorf("expected 81 cells, got %d", len(text))
+	}
+	puzzle := make([]byte, 81)
+	for i, c := range text {
+		v, ok := cellValue(c)
+		if !ok {
+			return "", fmt.Errorf("unexpected character %q", c)
+		}
+		puzzle[i] = v
+	}
+	return string(puzzle), nil
+}
+
+// parseLines reads one puzzle per line, as written by qqwing --one-line and
+// SudoCue (which uses 0 for empty cells)
+func parseLines(r io.Reader) ([]string, error) {
+	var puzzles []string
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		// SudoCue and some collections put a comment after the grid
+		if fields := strings.Fields(text); len(fields) > 1 {
+			text = fields[0]
+		}
+		puzzle, err := oneLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		puzzles = append(puzzles, puzzle)
+	}
+	return puzzles, scanner.Err()
+}
+
+// parseSadMan reads a SadMan Software .sdk file. Newer files have sections
+// like [Puzzle] and [State], of which only the givens in [Puzzle] are used;
+// older files only contain the nine rows.
+func parseSadMan(r io.Reader) ([]string, error) {
+	var b strings.Builder
+	section := "[puzzle]"
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "[") {
+			section = strings.ToLower(text)
+			continue
+		}
+		if section != "[puzzle]" || text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		b.WriteString(text)
+		b.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return parseGrid(strings.NewReader(b.String()))
+}
+
+// parseGrid reads puzzles drawn as text grids, such as Simple Sudoku .ss
+// files or grids using dots, zeros or underscores for empty cells. Borders
+// and separators are skipped, and every 81 cells make a puzzle.
+func parseGrid(r io.Reader) ([]string, error) {
+	var puzzles []string
+	var cells []byte
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		// a line of dashes separates bands, not cells
+		if strings.Trim(text, "-+|=* ") == "" {
+			continue
+		}
+		for _, c := range text {
+			if v, ok := cellValue(c); ok {
+				cells = append(cells, v)
+			}
+		}
+		if len(cells)%9 != 0 {
+			return nil, fmt.Errorf("puzzle %d: row %q does not have 9 cells", len(puzzles)+1, text)
+		}
+		if len(cells) == 81 {
+			puzzles = append(puzzles, string(cells))
+			cells = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cells) != 0 {
+		return nil, fmt.Errorf("puzzle %d: incomplete grid", len(puzzles)+1)
+	}
+	return puzzles, nil
+}
+
+// parseCSV reads the first field of every record that looks like a puzzle,
+// which skips header rows and any id or rating columns
+func parseCSV(r io.Reader) ([]string, error) {
+	var puzzles []string
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range record {
+			if puzzle, err := oneLine(strings.TrimSpace(field)); err == nil {
+				puzzles = append(puzzles, puzzle)
+				break
+			}
+		}
+	}
+	return puzzles, nil
+}
+
+// parseJSON reads the games of an export file
+func parseJSON(r io.Reader) ([]string, error) {
+	var file ExportFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	var puzzles []string
+	for k, game := range file.Puzzles {
+		if shape, err := NewShape(game.Variant, game.Size); err != nil || !shape.Classic() {
+			return nil, fmt.Errorf("puzzle %d: a %s sudoku of size %d, only classic 9 x 9 ones are read", k+1, game.Variant, game.Size)
+		}
+		puzzle, err := oneLine(game.Game)
+		if err != nil {
+			return nil, fmt.Errorf("puzzle %d: %v", k+1, err)
+		}
+		puzzles = append(puzzles, puzzle)
+	}
+	return puzzles, nil
+}
+
+// parseIPUZ reads the single puzzle of an ipuz file. Empty cells may be 0,
+// null or the file's empty value, as ipuz allows.
+func parseIPUZ(r io.Reader) ([]string, error) {
+	var file struct {
+		Kind   []string            `json:"kind"`
+		Empty  json.RawMessage     `json:"empty"`
+		Puzzle [][]json.RawMessage `json:"puzzle"`
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	sudoku := false
+	for _, kind := range file.Kind {
+		sudoku = sudoku || strings.HasPrefix(kind, "http://ipuz.org/sudoku")
+	}
+	if !sudoku {
+		return nil, fmt.Errorf("not an ipuz sudoku, kind %q", file.Kind)
+	}
+	if len(file.Puzzle) != 9 {
+		return nil, fmt.Errorf("expected 9 rows, got %d", len(file.Puzzle))
+	}
+
+	puzzle := make([]byte, 0, 81)
+	for r, row := range file.Puzzle {
+		if len(row) != 9 {
+			return nil, fmt.Errorf("row %d: expected 9 cells, got %d", r+1, len(row))
+		}
+		for _, cell := range row {
+			var n int
+			switch {
+			case string(cell) == "null" || len(file.Empty) > 0 && string(cell) == string(file.Empty):
+				puzzle = append(puzzle, '.')
+			case json.Unmarshal(cell, &n) == nil && n >= 0 && n <= 9:
+				puzzle = append(puzzle, ".123456789"[n])
+			default:
+				return nil, fmt.Errorf("row %d: unexpected cell %s", r+1, cell)
+			}
+		}
+	}
+	return []string{string(puzzle)}, nil
+}
+
+// Exported is an exported puzzle, in the fields of the json schema
+type Exported struct {
+	ID         int64  `json:"id"`
+	Difficulty string `json:"difficulty"`
+	Variant    string `json:"variant"`
+	Size       int    `json:"size"`
+	Cages      string `json:"cages,omitempty"` // a killer's, as FormatCages writes them
+	Givens     int    `json:"givens"`
+	Score      *int64 `json:"score"` // null until generate.go -rescore has rated it
+	Game       string `json:"game"`
+	Solution   string `json:"solution"`
+	Source     string `json:"source,omitempty"`
+}
+
+// ExportFile is the json export
+type ExportFile struct {
+	Version  int        `json:"version"`
+	Exported string     `json:"exported"`
+	Puzzles  []Exported `json:"puzzles"`
+}
+
+// IPUZ is the subset of the ipuz v2 sudoku fields we fill in, see
+// http://ipuz.org
+type IPUZ struct {
+	Version        string     `json:"version"`
+	Kind           []string   `json:"kind"`
+	Title          string     `json:"title"`
+	Difficulty     string     `json:"difficulty"`
+	Origin         string     `json:"origin,omitempty"`
+	UniqueID       string     `json:"uniqueid"`
+	Charset        string     `json:"charset"`
+	DisplayCharset bool       `json:"displaycharset"`
+	Boxes          bool       `json:"boxes"`
+	Empty          int        `json:"empty"`
+	Puzzle         [][]int    `json:"puzzle"`
+	Solution       [][]string `json:"solution"`
+	// ipuz has no rating, extensions go under a prefix of their own
+	Score *int64 `json:"drawsudokus:score,omitempty"`
+}
+
+// ToIPUZ splits a one-line game into rows
+func ToIPUZ(game Exported) IPUZ {
+	puzzle := make([][]int, 9)
+	solution := make([][]string, 9)
+	for r := 0; r < 9; r++ {
+		puzzle[r] = make([]int, 9)
+		solution[r] = make([]string, 9)
+		for c := 0; c < 9; c++ {
+			if n := game.Game[r*9+c]; n != '.' {
+				puzzle[r][c] = int(n - '0')
+			}
+			solution[r][c] = string(game.Solution[r*9+c])
+		}
+	}
+
+	return IPUZ{
+		Version:        "http://ipuz.org/v2",
+		Kind:           []string{"http://ipuz.org/sudoku#1"},
+		Title:          fmt.Sprintf("%s Sudoku #%d", strings.Title(game.Difficulty), game.ID),
+		Difficulty:     strings.Title(game.Difficulty),
+		Origin:         game.Source,
+		UniqueID:       fmt.Sprintf("sudoku_%s-%d", game.Difficulty, game.ID),
+		Charset:        "123456789",
+		DisplayCharset: true,
+		Boxes:          true,
+		Empty:          0,
+		Puzzle:         puzzle,
+		Solution:       solution,
+		Score:          game.Score,
+	}
+}
+
+// WriteExport writes the games in one of the export formats ipuz, json, csv
+// and oneline. An ipuz file holds a single puzzle, the first.
+func WriteExport(w io.Writer, format string, games []Exported, exported time.Time) error {
+	switch format {
+	case "ipuz":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ToIPUZ(games[0]))
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ExportFile{Version: 1, Exported: exported.UTC().Format(time.RFC3339), Puzzles: games})
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "difficulty", "variant", "givens", "score", "game", "solution", "source", "size", "cages"})
+		for _, game := range games {
+			score := ""
+			if game.Score != nil {
+				score = fmt.Sprint(*game.Score)
+			}
+			cw.Write([]string{fmt.Sprint(game.ID), game.Difficulty, game.Variant, fmt.Sprint(game.Givens), score, game.Game, game.Solution, game.Source, fmt.Sprint(game.Size), game.Cages})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "oneline":
+		// qqwing's format only has the givens, the solution is found again on import
+		for _, game := range games {
+			if _, err := fmt.Fprintln(w, game.Game); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,374 @@
+// Package sudoku holds what the programs in internal share about the
+// puzzles themselves: the grid, the solvers, the rater, the native
+// generator, the transformations and the file formats. Unlike the programs
+// it is a package of its own, so go test can check it.
+package sudoku
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Grid is a sudoku in qqwing's one-line order, row by row, 0 for an empty
+// cell
+type Grid [81]int
+
+// Parse reads a one-line game, anything but 1-9 is an empty cell
+func Parse(s string) Grid {
+	var g Grid
+	for i := 0; i < 81 && i < len(s); i++ {
+		if s[i] >= '1' && s[i] <= '9' {
+			g[i] = int(s[i] - '0')
+		}
+	}
+	return g
+}
+
+func (g Grid) String() string {
+	out := make([]byte, 81)
+	for i, v := range g {
+		if v == 0 {
+			out[i] = '.'
+		} else {
+			out[i] = byte('0' + v)
+		}
+	}
+	return string(out)
+}
+
+// Givens counts the filled cells
+func (g Grid) Givens() int {
+	n := 0
+	for _, v := range g {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// units lists the cells of every row, column and box, and peers the 20
+// cells sharing a unit with each cell
+var units [27][9]int
+var cellUnits [81][3]int
+var peers [81][20]int
+
+func init() {
+	for i := 0; i < 81; i++ {
+		r, c, b := i/9, i%9, (i/27)*3+(i%9)/3
+		units[r][c] = i
+		units[9+c][r] = i
+		units[18+b][(r%3)*3+c%3] = i
+		cellUnits[i] = [3]int{r, 9 + c, 18 + b}
+	}
+	for i := 0; i < 81; i++ {
+		n := 0
+		for j := 0; j < 81; j++ {
+			if j != i && (j/9 == i/9 || j%9 == i%9 || (j/27 == i/27 && (j%9)/3 == (i%9)/3)) {
+				peers[i][n] = j
+				n++
+			}
+		}
+	}
+}
+
+// candidates returns the digits still possible for cell i as bits 1-9
+func candidates(g *Grid, i int) uint16 {
+	used := uint16(0)
+	for _, p := range peers[i] {
+		used |= 1 << g[p]
+	}
+	return ^used & 0x3fe
+}
+
+func bitCount(b uint16) int {
+	n := 0
+	for ; b != 0; b &= b - 1 {
+		n++
+	}
+	return n
+}
+
+// Valid tells whether every row, column and box of a full grid holds 1 to 9
+func Valid(g Grid) bool {
+	for _, unit := range units {
+		seen := uint16(0)
+		for _, i := range unit {
+			seen |= 1 << g[i]
+		}
+		if seen != 0x3fe {
+			return false
+		}
+	}
+	return true
+}
+
+// Fill returns a random complete grid
+func Fill(rng *rand.Rand) Grid {
+	var g Grid
+	var fill func(i int) bool
+	fill = func(i int) bool {
+		if i == 81 {
+			return true
+		}
+		free := candidates(&g, i)
+		for _, v := range rng.Perm(9) {
+			if free&(1<<(v+1)) == 0 {
+				continue
+			}
+			g[i] = v + 1
+			if fill(i + 1) {
+				return true
+			}
+		}
+		g[i] = 0
+		return false
+	}
+	fill(0)
+	return g
+}
+
+// CountSolutions counts the solutions of g, stopping at limit. The givens
+// are not checked against each other.
+func CountSolutions(g Grid, limit int) int {
+	best, bestFree, bestCount := -1, uint16(0), 10
+	for i := 0; i < 81; i++ {
+		if g[i] != 0 {
+			continue
+		}
+		free := candidates(&g, i)
+		if n := bitCount(free); n < bestCount {
+			best, bestFree, bestCount = i, free, n
+			if n <= 1 {
+				break
+			}
+		}
+	}
+	if best < 0 {
+		return 1
+	}
+
+	count := 0
+	for v := 1; v <= 9 && count < limit; v++ {
+		if bestFree&(1<<v) != 0 {
+			g[best] = v
+			count += CountSolutions(g, limit-count)
+		}
+	}
+	return count
+}
+
+// SolveUnique checks the givens of a one-line puzzle and returns the
+// solution, failing if the puzzle has none or more than one
+func SolveUnique(puzzle string) (string, error) {
+	if len(puzzle) != 81 {
+		return "", fmt.Errorf("expected 81 cells, got %d", len(puzzle))
+	}
+	var grid [81]int
+	givens := 0
+	for i := 0; i < 81; i++ {
+		if puzzle[i] != '.' {
+			if puzzle[i] < '1' || puzzle[i] > '9' {
+				return "", fmt.Errorf("cell %d is %q, not a digit or '.'", i+1, puzzle[i])
+			}
+			grid[i] = int(puzzle[i] - '0')
+			givens++
+		}
+	}
+	if givens < 17 {
+		return "", fmt.Errorf("only %d givens, a unique solution needs at least 17", givens)
+	}
+
+	var rows, cols, boxes [9]uint16
+	for i, v := range grid {
+		if v == 0 {
+			continue
+		}
+		bit := uint16(1) << v
+		r, c, b := i/9, i%9, (i/27)*3+(i%9)/3
+		if rows[r]&bit != 0 || cols[c]&bit != 0 || boxes[b]&bit != 0 {
+			return "", fmt.Errorf("the given %d in row %d, column %d clashes with another given", v, r+1, c+1)
+		}
+		rows[r] |= bit
+		cols[c] |= bit
+		boxes[b] |= bit
+	}
+
+	var solution [81]int
+	solutions := 0
+
+	var search func() bool
+	search = func() bool {
+		// fill the empty cell with the fewest candidates first
+		best, bestCount := -1, 10
+		var bestFree uint16
+		for i, v := range grid {
+			if v != 0 {
+				continue
+			}
+			free := ^(rows[i/9] | cols[i%9] | boxes[(i/27)*3+(i%9)/3]) & 0x3fe
+			count := 0
+			for f := free; f != 0; f &= f - 1 {
+				count++
+			}
+			if count < bestCount {
+				best, bestCount, bestFree = i, count, free
+				if count <= 1 {
+					break
+				}
+			}
+		}
+		if best < 0 {
+			solutions++
+			solution = grid
+			return solutions > 1
+		}
+
+		r, c, b := best/9, best%9, (best/27)*3+(best%9)/3
+		for v := 1; v <= 9; v++ {
+			bit := uint16(1) << v
+			if bestFree&bit == 0 {
+				continue
+			}
+			grid[best] = v
+			rows[r] |= bit
+			cols[c] |= bit
+			boxes[b] |= bit
+			stop := search()
+			grid[best] = 0
+			rows[r] &^= bit
+			cols[c] &^= bit
+			boxes[b] &^= bit
+			if stop {
+				return true
+			}
+		}
+		return false
+	}
+	search()
+
+	switch solutions {
+	case 0:
+		return "", errors.New("no solution")
+	case 1:
+		return Grid(solution).String(), nil
+	}
+	return "", errors.New("more than one solution")
+}
+
+// Symmetries lists the symmetries the givens of a generated puzzle can have
+var Symmetries = []string{"none", "rotate180", "rotate90", "horizontal", "vertical", "diagonal", "dihedral"}
+
+// Orbits groups the cells that a symmetric puzzle gives or leaves empty
+// together. horizontal mirrors the top half onto the bottom, vertical the
+// left half onto the right, diagonal mirrors along the top-left to
+// bottom-right diagonal and dihedral combines all rotations and mirrors.
+// The halves are those of the printed grid: the books draw cell i in
+// column i/9 and row i%9, so a grid string holds the grid column by column.
+func Orbits(symmetry string) [][]int {
+	rotate90 := func(r, c int) (int, int) { return c, 8 - r }
+	moves := map[string][]func(r, c int) (int, int){
+		"none":       nil,
+		"rotate180":  {func(r, c int) (int, int) { return 8 - r, 8 - c }},
+		"rotate90":   {rotate90},
+		"horizontal": {func(r, c int) (int, int) { return 8 - r, c }},
+		"vertical":   {func(r, c int) (int, int) { return r, 8 - c }},
+		"diagonal":   {func(r, c int) (int, int) { return c, r }},
+		"dihedral":   {rotate90, func(r, c int) (int, int) { return r, 8 - c }},
+	}[symmetry]
+
+	var orbits [][]int
+	seen := [81]bool{}
+	for i := 0; i < 81; i++ {
+		if seen[i] {
+			continue
+		}
+		orbit := []int{i}
+		seen[i] = true
+		for k := 0; k < len(orbit); k++ {
+			for _, move := range moves {
+				r, c := move(orbit[k]%9, orbit[k]/9)
+				if j := c*9 + r; !seen[j] {
+					seen[j] = true
+					orbit = append(orbit, j)
+				}
+			}
+		}
+		orbits = append(orbits, orbit)
+	}
+	return orbits
+}
+
+// Reduce removes givens from the solution in random order, an orbit at a
+// time, as long as the puzzle keeps a single solution and at least
+// minGivens givens. It returns the puzzle and its number of givens.
+func Reduce(rng *rand.Rand, solution Grid, orbits [][]int, minGivens int) (Grid, int) {
+	puzzle := solution
+	givens := 81
+	for _, o := range rng.Perm(len(orbits)) {
+		if givens-len(orbits[o]) < minGivens {
+			continue
+		}
+		for _, i := range orbits[o] {
+			puzzle[i] = 0
+		}
+		if CountSolutions(puzzle, 2) != 1 {
+			for _, i := range orbits[o] {
+				puzzle[i] = solution[i]
+			}
+		} else {
+			givens -= len(orbits[o])
+		}
+	}
+	return puzzle, givens
+}
+
+// IsMinimal reports whether every given is needed for a unique solution.
+// Symmetric puzzles are reduced an orbit at a time, so they can still have
+// single givens to spare.
+func IsMinimal(puzzle Grid) bool {
+	for i := 0; i < 81; i++ {
+		if puzzle[i] == 0 {
+			continue
+		}
+		v := puzzle[i]
+		puzzle[i] = 0
+		unique := CountSolutions(puzzle, 2) == 1
+		puzzle[i] = v
+		if unique {
+			return false
+		}
+	}
+	return true
+}
+
+// Constraints say what the native generator's puzzles have to look like
+type Constraints struct {
+	Symmetry  string
+	MinGivens int
+	MaxGivens int // 0 for no limit
+	Minimal   bool
+}
+
+// Generate makes puzzles until one meets the constraints and is rated
+// difficulty, or any for the first that meets them, and returns it with its
+// solution and rating. It stops with the context's error when cancelled.
+func Generate(ctx context.Context, rng *rand.Rand, difficulty string, c Constraints) (puzzle, solution Grid, rating Rating, err error) {
+	orbits := Orbits(c.Symmetry)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Grid{}, Grid{}, Rating{}, err
+		}
+		solution := Fill(rng)
+		puzzle, givens := Reduce(rng, solution, orbits, c.MinGivens)
+		if c.MaxGivens != 0 && givens > c.MaxGivens || c.Minimal && !IsMinimal(puzzle) {
+			continue
+		}
+		rating := Rate(puzzle)
+		if difficulty == "any" || rating.Difficulty() == difficulty {
+			return puzzle, solution, rating, nil
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package sudoku
+
+// Rating counts the techniques needed to solve a puzzle
+type Rating struct {
+	singles       int
+	hiddenSingles int
+	intersections int // pointing pairs and box/line reductions
+	nakedPairs    int
+	hiddenPairs   int
+	guesses       int
+	unsolved      int // cells left when the techniques ran out
+}
+
+// Difficulty labels the stats like qqwing does: expert if the puzzle
+// needed a guess, intermediate for intersections or pairs, easy for hidden
+// singles and simple when naked singles were enough
+func (stats Rating) Difficulty() string {
+	switch {
+	case stats.guesses > 0:
+		return "expert"
+	case stats.intersections > 0 || stats.nakedPairs > 0 || stats.hiddenPairs > 0:
+		return "intermediate"
+	case stats.hiddenSingles > 0:
+		return "easy"
+	}
+	return "simple"
+}
+
+// Score puts the effort a puzzle takes into one number, to order the
+// puzzles of a difficulty from easier to harder. Every technique weighs
+// more than all the simpler ones a puzzle usually needs, and the cells
+// left for guessing make up for the rater stopping at the first guess.
+func (stats Rating) Score() int {
+	return stats.singles + 2*stats.hiddenSingles + 10*stats.intersections + 20*stats.nakedPairs + 30*stats.hiddenPairs + 100*stats.guesses + 5*stats.unsolved
+}
+
+// Rate solves the puzzle the way a person would, always using the
+// simplest technique that makes progress, and counts the techniques used
+func Rate(g Grid) Rating {
+	var stats Rating
+	cands := candidateGrid(g)
+	for {
+		d, ok := deduce(&g, &cands)
+		if !ok {
+			break
+		}
+		switch d.technique {
+		case NakedSingle:
+			stats.singles++
+		case HiddenSingle:
+			stats.hiddenSingles++
+		case Pointing, BoxLine:
+			stats.intersections++
+		case NakedPair:
+			stats.nakedPairs++
+		case HiddenPair:
+			stats.hiddenPairs++
+		}
+	}
+
+	// stuck: the rest needs guessing
+	for i := 0; i < 81; i++ {
+		if g[i] == 0 {
+			stats.unsolved++
+		}
+	}
+	if stats.unsolved > 0 {
+		stats.guesses++
+	}
+	return stats
+}
+
+// the techniques, simplest first
+const (
+	NakedSingle  = "Naked single"
+	HiddenSingle = "Hidden single"
+	Pointing     = "Pointing"
+	BoxLine      = "Box/line reduction"
+	NakedPair    = "Naked pair"
+	HiddenPair   = "Hidden pair"
+	Guess        = "Guess"
+)
+
+// deduction is one step of a technique: the cells it is about, the unit it
+// looks at (and the box of an intersection, whose unit is the line), its
+// digits, the cell it fills or -1 and the candidates it removes, in order
+type deduction struct {
+	technique string
+	cells     []int
+	unit, box int
+	digits    []int
+	placed    int
+	removed   []removal
+}
+
+type removal struct {
+	cell int
+	bits uint16
+}
+
+// candidateGrid returns the digits still possible for every empty cell
+func candidateGrid(g Grid) [81]uint16 {
+	var cands [81]uint16
+	for i := 0; i < 81; i++ {
+		if g[i] == 0 {
+			cands[i] = candidates(&g, i)
+		}
+	}
+	return cands
+}
+
+// place fills cell i and removes the digit from the candidates of its peers
+func place(g *Grid, cands *[81]uint16, i, v int) {
+	g[i] = v
+	cands[i] = 0
+	for _, p := range peers[i] {
+		cands[p] &^= 1 << v
+	}
+}
+
+// deduce takes the simplest technique that makes progress and applies it
+// to g and cands. It returns false when none does, which is when the grid
+// is solved or the rest needs guessing.
+func deduce(g *Grid, cands *[81]uint16) (deduction, bool) {
+	d := deduction{placed: -1}
+	// eliminate removes bits from cell i and records it
+	eliminate := func(i int, bits uint16) {
+		if bits &= cands[i]; bits != 0 {
+			cands[i] &^= bits
+			d.removed = append(d.removed, removal{i, bits})
+		}
+	}
+
+	// naked single: a cell with one candidate left
+	for i := 0; i < 81; i++ {
+		if g[i] == 0 && bitCount(cands[i]) == 1 {
+			v := Digits(cands[i])[0]
+			place(g, cands, i, v)
+			return deduction{technique: NakedSingle, cells: []int{i}, unit: -1, digits: []int{v}, placed: i}, true
+		}
+	}
+
+	// hidden single: a digit with one place left in a unit
+	for u := 0; u < 27; u++ {
+		for v := 1; v <= 9; v++ {
+			at, n := -1, 0
+			for _, i := range units[u] {
+				if cands[i]&(1<<v) != 0 {
+					at = i
+					n++
+				}
+			}
+			if n == 1 {
+				place(g, cands, at, v)
+				return deduction{technique: HiddenSingle, cells: []int{at}, unit: u, digits: []int{v}, placed: at}, true
+			}
+		}
+	}
+
+	// intersections: a digit confined to where a box and a line cross
+	// can be removed from the rest of the other unit
+	for b := 18; b < 27; b++ {
+		for line := 0; line < 18; line++ {
+			for v := 1; v <= 9; v++ {
+				bit := uint16(1) << v
+				var both []int
+				onlyBox, onlyLine := 0, 0
+				for _, i := range units[b] {
+					if cands[i]&bit != 0 {
+						if cellUnits[i][0] == line || cellUnits[i][1] == line {
+							both = append(both, i)
+						} else {
+							onlyBox++
+						}
+					}
+				}
+				if len(both) < 2 {
+					continue
+				}
+				for _, i := range units[line] {
+					if cands[i]&bit != 0 && cellUnits[i][2] != b {
+						onlyLine++
+					}
+				}
+				// pointing: only in the line within the box, clear the line
+				// box/line: only in the box within the line, clear the box
+				var clear int
+				switch {
+				case onlyBox == 0 && onlyLine > 0:
+					d.technique, clear = Pointing, line
+				case onlyLine == 0 && onlyBox > 0:
+					d.technique, clear = BoxLine, b
+				default:
+					continue
+				}
+				for _, i := range units[clear] {
+					if cellUnits[i][2] != b || (cellUnits[i][0] != line && cellUnits[i][1] != line) {
+						eliminate(i, bit)
+					}
+				}
+				d.cells, d.unit, d.box, d.digits = both, line, b, []int{v}
+				return d, true
+			}
+		}
+	}
+
+	// naked pair: two cells of a unit with the same two candidates
+	for u := 0; u < 27; u++ {
+		for x := 0; x < 9; x++ {
+			a := units[u][x]
+			if bitCount(cands[a]) != 2 {
+				continue
+			}
+			for y := x + 1; y < 9; y++ {
+				b := units[u][y]
+				if cands[b] != cands[a] {
+					continue
+				}
+				pair := cands[a]
+				for _, i := range units[u] {
+					if i != a && i != b {
+						eliminate(i, pair)
+					}
+				}
+				if len(d.removed) > 0 {
+					d.technique, d.cells, d.unit, d.digits = NakedPair, []int{a, b}, u, Digits(pair)
+					return d, true
+				}
+			}
+		}
+	}
+
+	// hidden pair: two digits that only fit the same two cells of a unit
+	for u := 0; u < 27; u++ {
+		var where [10]uint16
+		for k, i := range units[u] {
+			for v := 1; v <= 9; v++ {
+				if cands[i]&(1<<v) != 0 {
+					where[v] |= 1 << k
+				}
+			}
+		}
+		for v := 1; v <= 9; v++ {
+			if bitCount(where[v]) != 2 {
+				continue
+			}
+			for w := v + 1; w <= 9; w++ {
+				if where[w] != where[v] {
+					continue
+				}
+				pair := uint16(1)<<v | uint16(1)<<w
+				var cells []int
+				for k, i := range units[u] {
+					if where[v]&(1<<k) != 0 {
+						cells = append(cells, i)
+						eliminate(i, ^pair)
+					}
+				}
+				if len(d.removed) > 0 {
+					d.technique, d.cells, d.unit, d.digits = HiddenPair, cells, u, []int{v, w}
+					return d, true
+				}
+			}
+		}
+	}
+	return d, false
+}
+
+// Digits lists the digits of a candidate set, bits 1-9
+func Digits(bits uint16) []int {
+	var ds []int
+	for v := 1; v <= 9; v++ {
+		if bits&(1<<v) != 0 {
+			ds = append(ds, v)
+		}
+	}
+	return ds
+}
@@ -0,0 +1,588 @@
+package sudoku
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// randomPuzzle fills about half the cells of a shifted pattern, which is a
+// valid grid; the parsers don't mind whether the puzzle has one solution
+func randomPuzzle(rng *rand.Rand) string {
+	digits := rng.Perm(9)
+	puzzle := make([]byte, 81)
+	for i := range puzzle {
+		if rng.Intn(2) == 0 {
+			puzzle[i] = '.'
+		} else {
+			puzzle[i] = byte('1' + digits[(i/9*3+i/27+i%9)%9])
+		}
+	}
+	return string(puzzle)
+}
+
+// writePuzzles writes puzzles the way the format's own tools do, the
+// opposite of ReadPuzzles
+func writePuzzles(puzzles []string, format string) string {
+	var b strings.Builder
+	for n, puzzle := range puzzles {
+		switch format {
+		case "oneline":
+			b.WriteString(puzzle + "\n")
+		case "sdm":
+			b.WriteString(strings.ReplaceAll(puzzle, ".", "0") + "\n")
+		case "csv":
+			if n == 0 {
+				b.WriteString("id,puzzle,rating\n")
+			}
+			fmt.Fprintf(&b, "%d,%s,1.5\n", n+1, puzzle)
+		case "sdk":
+			// SadMan files hold a single puzzle
+			b.WriteString("[Puzzle]\n")
+			for r := 0; r < 9; r++ {
+				b.WriteString(puzzle[r*9:r*9+9] + "\n")
+			}
+			b.WriteString("[State]\n" + strings.Repeat("123456789\n", 9))
+			return b.String()
+		case "ss":
+			for r := 0; r < 9; r++ {
+				if r%3 == 0 {
+					b.WriteString("*-----------*\n")
+				}
+				row := puzzle[r*9 : r*9+9]
+				fmt.Fprintf(&b, "|%s|%s|%s|\n", row[0:3], row[3:6], row[6:9])
+			}
+			b.WriteString("*-----------*\n")
+		case "grid":
+			for r := 0; r < 9; r++ {
+				b.WriteString(strings.Join(strings.Split(puzzle[r*9:r*9+9], ""), " ") + "\n")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func TestReadPuzzles(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, format := range []string{"oneline", "sdm", "sdk", "ss", "grid", "csv"} {
+		for k := 0; k < 50; k++ {
+			puzzles := []string{randomPuzzle(rng), randomPuzzle(rng), randomPuzzle(rng)}
+			if format == "sdk" {
+				puzzles = puzzles[:1]
+			}
+			data := writePuzzles(puzzles, format)
+			got, err := ReadPuzzles(strings.NewReader(data), format)
+			if err != nil || !reflect.DeepEqual(got, puzzles) {
+				t.Fatalf("%s: read %q, %v from %q", format, got, err, data)
+			}
+		}
+	}
+}
+
+// fuzzParser seeds the fuzzer with files written in the format and checks
+// the parser returns an error or puzzles of 81 cells, but never panics
+func fuzzParser(f *testing.F, format string, seeds ...string) {
+	rng := rand.New(rand.NewSource(1))
+	for k := 0; k < 3; k++ {
+		puzzles := []string{randomPuzzle(rng), randomPuzzle(rng)}
+		if format == "sdk" {
+			puzzles = puzzles[:1]
+		}
+		f.Add(writePuzzles(puzzles, format))
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		puzzles, err := ReadPuzzles(strings.NewReader(data), format)
+		if err != nil {
+			return
+		}
+		for _, puzzle := range puzzles {
+			if len(puzzle) != 81 || strings.Trim(puzzle, ".123456789") != "" {
+				t.Fatalf("read %q", puzzle)
+			}
+		}
+	})
+}
+
+func FuzzParseLines(f *testing.F)   { fuzzParser(f, "oneline", "# comment\n\n") }
+func FuzzParseSudoCue(f *testing.F) { fuzzParser(f, "sdm") }
+func FuzzParseSadMan(f *testing.F)  { fuzzParser(f, "sdk", "[puzzle]\n[state]\n") }
+func FuzzParseGrid(f *testing.F)    { fuzzParser(f, "grid", "*---*\n|...|\n") }
+func FuzzParseCSV(f *testing.F)     { fuzzParser(f, "csv", "\"a\nb\",c\n") }
+
+func FuzzParseJSON(f *testing.F) {
+	fuzzParser(f, "json", `{"puzzles":[{"game":""}]}`, `{"puzzles":null}`)
+}
+
+func FuzzParseIPUZ(f *testing.F) {
+	fuzzParser(f, "ipuz", `{"kind":["http://ipuz.org/sudoku#1"],"empty":"x","puzzle":[["x"]]}`)
+}
+
+// generated makes amount puzzles of the difficulty from the seed
+func generated(t *testing.T, seed int64, amount int, difficulty string, c Constraints) (puzzles, solutions []Grid) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	for k := 0; k < amount; k++ {
+		puzzle, solution, _, err := Generate(context.Background(), rng, difficulty, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		puzzles = append(puzzles, puzzle)
+		solutions = append(solutions, solution)
+	}
+	return puzzles, solutions
+}
+
+func TestGenerate(t *testing.T) {
+	amount := 10
+	if testing.Short() {
+		amount = 2
+	}
+	for _, difficulty := range []string{"simple", "easy", "intermediate", "expert"} {
+		for _, symmetry := range Symmetries {
+			c := Constraints{Symmetry: symmetry}
+			puzzles, solutions := generated(t, int64(len(difficulty)*100+len(symmetry)), amount, difficulty, c)
+			for k, puzzle := range puzzles {
+				solution := solutions[k]
+				name := fmt.Sprintf("%s %s #%d %s", difficulty, symmetry, k+1, puzzle)
+
+				if !Valid(solution) {
+					t.Errorf("%s: the solution %s breaks a rule", name, solution)
+				}
+				for i := range puzzle {
+					if puzzle[i] != 0 && puzzle[i] != solution[i] {
+						t.Errorf("%s: given %d of cell %d is not in the solution", name, puzzle[i], i)
+					}
+				}
+				if n := CountSolutions(puzzle, 2); n != 1 {
+					t.Errorf("%s: %d solutions", name, n)
+				}
+				if found, err := SolveUnique(puzzle.String()); err != nil || found != solution.String() {
+					t.Errorf("%s: SolveUnique found %s, %v", name, found, err)
+				}
+				for _, orbit := range Orbits(symmetry) {
+					for _, i := range orbit {
+						if (puzzle[i] == 0) != (puzzle[orbit[0]] == 0) {
+							t.Errorf("%s: the givens are not %s symmetric", name, symmetry)
+						}
+					}
+				}
+				if label := Rate(puzzle).Difficulty(); label != difficulty {
+					t.Errorf("%s: rated %s", name, label)
+				}
+			}
+		}
+	}
+}
+
+// The books print cell i in column i/9 and row i%9, so the mirrors have to
+// pair the cells that are mirrored on the page, not in the grid string.
+func TestOrbitsPrinted(t *testing.T) {
+	printed := func(i int) (int, int) { return i % 9, i / 9 }
+	mirrors := map[string]func(r, c int) (int, int){
+		"horizontal": func(r, c int) (int, int) { return 8 - r, c },
+		"vertical":   func(r, c int) (int, int) { return r, 8 - c },
+		"diagonal":   func(r, c int) (int, int) { return c, r },
+		"rotate180":  func(r, c int) (int, int) { return 8 - r, 8 - c },
+	}
+	for symmetry, mirror := range mirrors {
+		for _, orbit := range Orbits(symmetry) {
+			cells := map[[2]int]bool{}
+			for _, i := range orbit {
+				r, c := printed(i)
+				cells[[2]int{r, c}] = true
+			}
+			for _, i := range orbit {
+				r, c := printed(i)
+				if mr, mc := mirror(r, c); !cells[[2]int{mr, mc}] {
+					t.Errorf("%s: cell %d is printed in row %d, column %d, but its mirror in row %d, column %d is not in its orbit %v", symmetry, i, r+1, c+1, mr+1, mc+1, orbit)
+				}
+			}
+		}
+	}
+
+	// the top left corner is cell 0, the bottom left cell 8 and the top right cell 72
+	for _, c := range []struct {
+		symmetry string
+		cells    []int
+	}{{"horizontal", []int{0, 8}}, {"vertical", []int{0, 72}}} {
+		for _, orbit := range Orbits(c.symmetry) {
+			if orbit[0] == 0 && !reflect.DeepEqual(orbit, c.cells) {
+				t.Errorf("%s: the top left corner is grouped with %v, want %v", c.symmetry, orbit, c.cells)
+			}
+		}
+	}
+}
+
+func TestGenerateGivens(t *testing.T) {
+	for _, c := range []Constraints{{MinGivens: 30}, {MaxGivens: 26}, {Minimal: true}, {Symmetry: "rotate180", MinGivens: 28, MaxGivens: 34}} {
+		puzzles, _ := generated(t, 7, 3, "any", c)
+		for _, puzzle := range puzzles {
+			givens := puzzle.Givens()
+			if givens < c.MinGivens || c.MaxGivens != 0 && givens > c.MaxGivens {
+				t.Errorf("%+v: %s has %d givens", c, puzzle, givens)
+			}
+			if c.Minimal && !IsMinimal(puzzle) {
+				t.Errorf("%+v: %s is not minimal", c, puzzle)
+			}
+		}
+	}
+}
+
+func TestGenerateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := Generate(ctx, rand.New(rand.NewSource(1)), "expert", Constraints{}); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+// every shape's puzzles have one solution, which holds every digit once in
+// each column, row and box of every grid and agrees on the cells a samurai's
+// grids share, and a killer's cages add up
+func TestGenerateShapes(t *testing.T) {
+	for _, c := range []struct {
+		variant string
+		size    int
+	}{{"classic", 4}, {"classic", 6}, {"killer", 6}, {"killer", 9}, {"samurai", 9}} {
+		s, err := NewShape(c.variant, c.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, difficulty := range []string{"simple", "easy", "expert"} {
+			p, err := s.Generate(context.Background(), rand.New(rand.NewSource(int64(k+1))), difficulty)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := fmt.Sprintf("%s %s", s.Name(), difficulty)
+
+			solution, err := s.values(p.Solution)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for u, unit := range s.units {
+				seen := uint16(0)
+				for _, b := range unit {
+					seen |= 1 << solution[b]
+				}
+				if seen != 1<<(s.Size+1)-2 {
+					t.Errorf("%s: unit %d of the solution %s is %b", name, u, p.Solution, seen)
+				}
+			}
+			for _, cage := range p.Cages {
+				sum := 0
+				for _, cell := range cage.Cells {
+					sum += int(p.Solution[cell] - '0')
+				}
+				if sum != cage.Sum {
+					t.Errorf("%s: cage %v adds up to %d", name, cage, sum)
+				}
+			}
+			if (c.variant == "killer") != (len(p.Cages) > 0) {
+				t.Errorf("%s: %d cages", name, len(p.Cages))
+			}
+
+			for i := range p.Game {
+				if p.Game[i] != '.' && p.Game[i] != p.Solution[i] {
+					t.Errorf("%s: given %c of cell %d is not in the solution", name, p.Game[i], i)
+				}
+			}
+			if found, err := s.Solve(p.Game, p.Cages); err != nil || found != p.Solution {
+				t.Errorf("%s: Solve found %s, %v", name, found, err)
+			}
+			if givens := s.Givens(p.Game); givens != p.Givens || p.Score != len(s.Cells())-givens {
+				t.Errorf("%s: %d givens and a score of %d, counted %d givens", name, p.Givens, p.Score, givens)
+			}
+			if floor := variantFloors[c.variant][difficulty]; float64(p.Givens) < floor*float64(len(s.Cells())) {
+				t.Errorf("%s: %d givens of %d cells, below %v", name, p.Givens, len(s.Cells()), floor)
+			}
+		}
+	}
+}
+
+func TestShapes(t *testing.T) {
+	for _, c := range []struct {
+		variant string
+		size    int
+		length  int
+		cells   int
+		ok      bool
+	}{
+		{"", 0, 81, 81, true},
+		{"classic", 4, 16, 16, true},
+		{"classic", 6, 36, 36, true},
+		{"killer", 9, 81, 81, true},
+		{"samurai", 9, 405, 369, true},
+		{"samurai", 6, 0, 0, false},
+		{"classic", 8, 0, 0, false},
+		{"jigsaw", 9, 0, 0, false},
+	} {
+		s, err := NewShape(c.variant, c.size)
+		if (err == nil) != c.ok {
+			t.Errorf("%s %d: %v", c.variant, c.size, err)
+			continue
+		}
+		if err == nil && (s.Len() != c.length || len(s.Cells()) != c.cells) {
+			t.Errorf("%s %d: %d cells in a game string, %d on the board, want %d and %d", c.variant, c.size, s.Len(), len(s.Cells()), c.length, c.cells)
+		}
+	}
+
+	// a 6 x 6 box is three columns across and two rows down as it is printed
+	s, _ := NewShape("classic", 6)
+	board := s.Board("12....34..........................56")
+	if want := []string{"13....", "24....", "......", "......", ".....5", ".....6"}; !reflect.DeepEqual(board, want) {
+		t.Errorf("board %q, want %q", board, want)
+	}
+	if _, err := s.Solve("11..................................", nil); err == nil {
+		t.Error("clashing givens in a column were solved")
+	}
+
+	// the samurai's middle grid shares its corner boxes
+	s, _ = NewShape("samurai", 9)
+	game := []byte(strings.Repeat(".", 405))
+	game[80] = '5'      // bottom right of the top left grid
+	game[2*81+20] = '6' // the same cell in the middle grid
+	if _, err := s.Solve(string(game), nil); err == nil || !strings.Contains(err.Error(), "in another") {
+		t.Errorf("a shared cell with two digits gave %v", err)
+	}
+}
+
+func TestCages(t *testing.T) {
+	cages := []Cage{{Sum: 10, Cells: []int{0, 1, 9}}, {Sum: 7, Cells: []int{2}}}
+	s := FormatCages(cages)
+	if s != "10:0,1,9;7:2" {
+		t.Errorf("formatted as %q", s)
+	}
+	if parsed, err := ParseCages(s); err != nil || !reflect.DeepEqual(parsed, cages) {
+		t.Errorf("parsed back as %v, %v", parsed, err)
+	}
+	for _, bad := range []string{"10", "x:1", "3:1,a"} {
+		if _, err := ParseCages(bad); err == nil {
+			t.Errorf("%q was parsed", bad)
+		}
+	}
+}
+
+// a transformed puzzle is the same puzzle: one solution, the transformed
+// one, the same rating and the same canonical form
+func TestTransform(t *testing.T) {
+	amount := 5
+	if testing.Short() {
+		amount = 1
+	}
+	rng := rand.New(rand.NewSource(3))
+	for _, difficulty := range []string{"simple", "easy", "intermediate", "expert"} {
+		puzzles, solutions := generated(t, 11, amount, difficulty, Constraints{})
+		for k, puzzle := range puzzles {
+			canonical := Canonical(puzzle)
+			if canonical.Givens() != puzzle.Givens() || CountSolutions(canonical, 2) != 1 {
+				t.Errorf("%s: the canonical form %s is not the same puzzle", puzzle, canonical)
+			}
+			if again := Canonical(canonical); again != canonical {
+				t.Errorf("%s: the canonical form %s has the canonical form %s", puzzle, canonical, again)
+			}
+			solution := Canonical(solutions[k])
+			for n := 0; n < 3; n++ {
+				move := RandomTransform(rng)
+				moved := move.Apply(puzzle)
+				if found, err := SolveUnique(moved.String()); err != nil || found != move.Apply(solutions[k]).String() {
+					t.Errorf("%s moved to %s: solved as %s, %v", puzzle, moved, found, err)
+				}
+				if label := Rate(moved).Difficulty(); label != difficulty {
+					t.Errorf("%s moved to %s: rated %s", puzzle, moved, label)
+				}
+				if got := Canonical(moved); got != canonical {
+					t.Errorf("%s moved to %s: canonical form %s, %s before", puzzle, moved, got, canonical)
+				}
+				if got := Canonical(move.Apply(solutions[k])); got != solution {
+					t.Errorf("the solution of %s moved: canonical form %s, %s before", puzzle, got, solution)
+				}
+			}
+		}
+	}
+}
+
+func TestCanonicalTellsApart(t *testing.T) {
+	puzzles, _ := generated(t, 5, 4, "any", Constraints{})
+	seen := map[Grid]Grid{}
+	for _, puzzle := range puzzles {
+		canonical := Canonical(puzzle)
+		if other, ok := seen[canonical]; ok {
+			t.Errorf("%s and %s have the same canonical form %s", other, puzzle, canonical)
+		}
+		seen[canonical] = puzzle
+	}
+}
+
+// exported games read back as the same puzzles, and the json and ipuz
+// files keep every field
+func TestExportRoundTrip(t *testing.T) {
+	puzzles, solutions := generated(t, 13, 4, "any", Constraints{})
+	score := int64(42)
+	var games []Exported
+	for k, puzzle := range puzzles {
+		game := Exported{ID: int64(k + 1), Difficulty: "easy", Variant: "classic", Size: 9, Givens: puzzle.Givens(), Game: puzzle.String(), Solution: solutions[k].String(), Source: fmt.Sprintf("test#%d", k+1)}
+		if k%2 == 0 {
+			game.Score = &score
+		}
+		games = append(games, game)
+	}
+	exported := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, format := range []string{"json", "csv", "oneline", "ipuz"} {
+		want := games
+		if format == "ipuz" {
+			want = games[:1]
+		}
+		var b bytes.Buffer
+		if err := WriteExport(&b, format, want, exported); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		data := b.String()
+
+		got, err := ReadPuzzles(strings.NewReader(data), format)
+		if err != nil {
+			t.Fatalf("%s: %v reading %q", format, err, data)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: read %d of %d puzzles", format, len(got), len(want))
+		}
+		for k := range want {
+			if got[k] != want[k].Game {
+				t.Errorf("%s: read %s, wrote %s", format, got[k], want[k].Game)
+			}
+			if solution, err := SolveUnique(got[k]); err != nil || solution != want[k].Solution {
+				t.Errorf("%s: %s solved as %s, %v", format, got[k], solution, err)
+			}
+		}
+
+		switch format {
+		case "json":
+			var file ExportFile
+			if err := json.Unmarshal(b.Bytes(), &file); err != nil || !reflect.DeepEqual(file.Puzzles, want) || file.Exported != "2024-01-02T03:04:05Z" {
+				t.Errorf("json: read back %+v, %v", file, err)
+			}
+		case "ipuz":
+			var file IPUZ
+			if err := json.Unmarshal(b.Bytes(), &file); err != nil || !reflect.DeepEqual(file, ToIPUZ(want[0])) {
+				t.Errorf("ipuz: read back %+v, %v", file, err)
+			}
+		}
+	}
+}
+
+func TestSolveUnique(t *testing.T) {
+	puzzles, solutions := generated(t, 17, 1, "any", Constraints{})
+	puzzle := puzzles[0].String()
+
+	for _, c := range []struct {
+		name, puzzle, err string
+	}{
+		{"short", puzzle[:80], "expected 81 cells"},
+		{"letters", "a" + puzzle[1:], "not a digit"},
+		{"few givens", "123456789" + strings.Repeat(".", 72), "only 9 givens"},
+		{"clash", strings.Repeat("1", 81), "clashes"},
+	} {
+		if _, err := SolveUnique(c.puzzle); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got %v, want an error with %q", c.name, err, c.err)
+		}
+	}
+
+	// a full row and a few other givens leave many solutions
+	if _, err := SolveUnique(solutions[0].String()[:27] + strings.Repeat(".", 54)); err == nil || err.Error() != "more than one solution" {
+		t.Errorf("got %v for a puzzle with many solutions", err)
+	}
+}
+
+// Replaying the explained steps has to solve the puzzle: every placed digit
+// and no removed candidate is the solution's, the picture of each step is
+// the position before it and the techniques are the ones Rate counts
+func TestExplain(t *testing.T) {
+	amount := 4
+	if testing.Short() {
+		amount = 1
+	}
+	for _, difficulty := range []string{"simple", "easy", "intermediate", "expert"} {
+		puzzles, solutions := generated(t, int64(len(difficulty)), amount, difficulty, Constraints{})
+		for k, puzzle := range puzzles {
+			solution := solutions[k]
+			name := fmt.Sprintf("%s #%d %s", difficulty, k+1, puzzle)
+
+			g := puzzle
+			used := map[string]int{}
+			for n, s := range Explain(puzzle, solution) {
+				if s.Before != g {
+					t.Fatalf("%s: step %d starts from %s, not %s", name, n+1, s.Before, g)
+				}
+				used[s.Technique]++
+				for cell, bits := range s.Removed {
+					if bits&(1<<solution[cell]) != 0 {
+						t.Errorf("%s: step %d %q removes the solution's %d from %s", name, n+1, s.Text, solution[cell], cellName(cell))
+					}
+				}
+				if s.PlacedAt >= 0 {
+					if s.Placed.Digit != solution[s.PlacedAt] || s.Placed.Cell != cellName(s.PlacedAt) {
+						t.Errorf("%s: step %d %q places %+v, the solution has %d", name, n+1, s.Text, *s.Placed, solution[s.PlacedAt])
+					}
+					g[s.PlacedAt] = s.Placed.Digit
+				}
+			}
+			if g != solution {
+				t.Errorf("%s: the steps end in %s, not the solution", name, g)
+			}
+
+			if label := Rate(puzzle).Difficulty(); (used[Guess] > 0) != (label == "expert") {
+				t.Errorf("%s: rated %s but explained with %d guesses", name, label, used[Guess])
+			}
+			if used[Guess] == 0 && Rate(puzzle).Score() != used[NakedSingle]+2*used[HiddenSingle]+10*(used[Pointing]+used[BoxLine])+20*used[NakedPair]+30*used[HiddenPair] {
+				t.Errorf("%s: rated %d, explained with %v", name, Rate(puzzle).Score(), used)
+			}
+		}
+	}
+}
+
+func TestExplainSteps(t *testing.T) {
+	puzzle := Parse("4.....8.5.3..........7......2.....6.....8.4......1.......6.3.7.5..2.....1.4......")
+	solution := Parse("417369825632158947958724316825437169791586432346912758289643571573291684164875293")
+	steps := Explain(puzzle, solution)
+
+	// the books print cell i in column i/9 and row i%9
+	want := Step{
+		Technique: HiddenSingle,
+		Cells:     []string{"r2c6"},
+		Placed:    &Placement{Cell: "r2c6", Digit: 4},
+		Text:      "r2c6 is the only place for 4 in row 2",
+	}
+	first := steps[0]
+	if first.Technique != want.Technique || !reflect.DeepEqual(first.Cells, want.Cells) || !reflect.DeepEqual(first.Placed, want.Placed) || first.Text != want.Text {
+		t.Errorf("first step %+v, want %+v", first, want)
+	}
+	if first.PlacedAt != 5*9+1 || solution[first.PlacedAt] != 4 {
+		t.Errorf("the first step fills cell %d", first.PlacedAt)
+	}
+
+	b, err := json.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != `{"technique":"Hidden single","cells":["r2c6"],"placed":{"cell":"r2c6","digit":4},"text":"r2c6 is the only place for 4 in row 2"}` {
+		t.Errorf("json %s", got)
+	}
+
+	for n, s := range steps {
+		if s.Technique == BoxLine || s.Technique == Pointing {
+			if len(s.Eliminated) == 0 || !strings.Contains(s.Text, ", removing ") {
+				t.Errorf("step %d %q removes nothing", n+1, s.Text)
+			}
+		}
+	}
+}
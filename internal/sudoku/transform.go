@@ -0,0 +1,110 @@
+package sudoku
+
+import "math/rand"
+
+// Transform is one of the changes that turn a sudoku into an equivalent
+// one: relabel the digits, swap rows within a band, swap bands, the same
+// for columns and stacks, and maybe transpose. Puzzles and solutions moved
+// by the same transform stay a pair.
+type Transform struct {
+	Digits    [9]int // the digit 1-9 each digit becomes, less one
+	Rows      [9]int // the row of the original each row is taken from
+	Cols      [9]int
+	Transpose bool
+}
+
+// lineOrders lists the 1296 orders of nine rows that keep the bands: the
+// bands in any order, the rows of each band in any order
+var lineOrders [][9]int
+
+func init() {
+	perms := [][3]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+	for _, bands := range perms {
+		for _, a := range perms {
+			for _, b := range perms {
+				for _, c := range perms {
+					var order [9]int
+					for k, within := range [3][3]int{a, b, c} {
+						for l, line := range within {
+							order[k*3+l] = bands[k]*3 + line
+						}
+					}
+					lineOrders = append(lineOrders, order)
+				}
+			}
+		}
+	}
+}
+
+// RandomTransform picks one of the transforms at random
+func RandomTransform(rng *rand.Rand) Transform {
+	var t Transform
+	copy(t.Digits[:], rng.Perm(9))
+	t.Rows = lineOrders[rng.Intn(len(lineOrders))]
+	t.Cols = lineOrders[rng.Intn(len(lineOrders))]
+	t.Transpose = rng.Intn(2) == 1
+	return t
+}
+
+// Apply moves the grid, empty cells stay empty
+func (t Transform) Apply(g Grid) Grid {
+	var out Grid
+	for r := 0; r < 9; r++ {
+		for c := 0; c < 9; c++ {
+			v := g[t.Rows[r]*9+t.Cols[c]]
+			if v != 0 {
+				v = t.Digits[v-1] + 1
+			}
+			if t.Transpose {
+				out[c*9+r] = v
+			} else {
+				out[r*9+c] = v
+			}
+		}
+	}
+	return out
+}
+
+// Canonical returns the same grid for every sudoku that a Transform turns
+// into another: of all the ways to order the rows and columns, with or
+// without transposing, the one that reads smallest row by row once the
+// digits are numbered in the order they first appear. Empty cells read
+// smallest of all.
+func Canonical(g Grid) Grid {
+	best := Grid{}
+	found := false
+	for _, h := range [2]Grid{g, Transform{Digits: [9]int{0, 1, 2, 3, 4, 5, 6, 7, 8}, Rows: lineOrders[0], Cols: lineOrders[0], Transpose: true}.Apply(g)} {
+		for _, rows := range lineOrders {
+			for _, cols := range lineOrders {
+				// compare while numbering the digits, most orders lose
+				// within the first few cells
+				var label [10]int
+				next := 1
+				better := !found
+				for k := 0; k < 81; k++ {
+					v := h[rows[k/9]*9+cols[k%9]]
+					if v != 0 {
+						if label[v] == 0 {
+							label[v] = next
+							next++
+						}
+						v = label[v]
+					}
+					if better {
+						best[k] = v
+						continue
+					}
+					if v > best[k] {
+						break
+					}
+					if v < best[k] {
+						better = true
+						best[k] = v
+					}
+				}
+				found = true
+			}
+		}
+	}
+	return best
+}
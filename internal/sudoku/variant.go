@@ -0,0 +1,567 @@
+package sudoku
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Variants are the kinds of sudoku the generator makes and the books print
+var Variants = []string{"classic", "killer", "samurai"}
+
+// Shape is the layout of a variant: its digits, how its boxes are cut and,
+// for samurai, where its grids lie. A game string holds the grids one after
+// the other, each column by column the way the books print it, so cell i of
+// a grid is in its column i/Size and row i%Size. The corner boxes a
+// samurai's middle grid shares with the others are in the string twice.
+type Shape struct {
+	Variant string
+	Size    int      // digits, and cells across and down a grid
+	BoxW    int      // cells across a box
+	BoxH    int      // cells down a box
+	Grids   [][2]int // column and row of the top left cell of every grid
+	Width   int      // cells across and down all the grids
+
+	board     []int   // the board cell, column*Width+row, of every cell of a game string
+	units     [][]int // the board cells of every column, row and box
+	cellUnits [][]int // the units of every board cell, none outside the grids
+}
+
+// NewShape returns the shape of the variant and size, classic and 9 when
+// they are empty
+func NewShape(variant string, size int) (Shape, error) {
+	if variant == "" {
+		variant = "classic"
+	}
+	if size == 0 {
+		size = 9
+	}
+	box, ok := map[int][2]int{4: {2, 2}, 6: {3, 2}, 9: {3, 3}}[size]
+	switch {
+	case variant != "classic" && variant != "killer" && variant != "samurai":
+		return Shape{}, fmt.Errorf("unknown variant %q, one of %s", variant, strings.Join(Variants, ", "))
+	case !ok:
+		return Shape{}, fmt.Errorf("no sudokus of size %d, one of 4, 6, 9", size)
+	case variant == "samurai" && size != 9:
+		return Shape{}, errors.New("a samurai sudoku is made of 9 x 9 grids")
+	}
+
+	s := Shape{Variant: variant, Size: size, BoxW: box[0], BoxH: box[1], Grids: [][2]int{{0, 0}}, Width: size}
+	if variant == "samurai" {
+		s.Grids = [][2]int{{0, 0}, {12, 0}, {6, 6}, {0, 12}, {12, 12}}
+		s.Width = 21
+	}
+
+	n := size
+	s.cellUnits = make([][]int, s.Width*s.Width)
+	for _, g := range s.Grids {
+		at := func(col, row int) int { return (g[0]+col)*s.Width + g[1] + row }
+		for i := 0; i < n*n; i++ {
+			s.board = append(s.board, at(i/n, i%n))
+		}
+		for k := 0; k < n; k++ {
+			var col, row, box []int
+			for m := 0; m < n; m++ {
+				col = append(col, at(k, m))
+				row = append(row, at(m, k))
+				box = append(box, at((k%(n/s.BoxW))*s.BoxW+m%s.BoxW, (k/(n/s.BoxW))*s.BoxH+m/s.BoxW))
+			}
+			s.units = append(s.units, col, row, box)
+		}
+	}
+	for u, unit := range s.units {
+		for _, b := range unit {
+			s.cellUnits[b] = append(s.cellUnits[b], u)
+		}
+	}
+	return s, nil
+}
+
+// Classic tells whether the shape is the classic 9 x 9 grid that Rate,
+// Explain and the qqwing formats know
+func (s Shape) Classic() bool {
+	return s.Variant == "classic" && s.Size == 9
+}
+
+// Name is the variant and size as a -fill quota names them: killer,
+// classic6 or samurai
+func (s Shape) Name() string {
+	if s.Size == 9 {
+		return s.Variant
+	}
+	return fmt.Sprint(s.Variant, s.Size)
+}
+
+// Len is the length of a game string
+func (s Shape) Len() int {
+	return len(s.board)
+}
+
+// Cells lists the board cells the grids cover, in order
+func (s Shape) Cells() []int {
+	var cells []int
+	for b, units := range s.cellUnits {
+		if len(units) > 0 {
+			cells = append(cells, b)
+		}
+	}
+	return cells
+}
+
+// Board lays a game string out as it is printed, a string a row, with a
+// space for the cells no grid covers
+func (s Shape) Board(game string) []string {
+	rows := make([][]byte, s.Width)
+	for r := range rows {
+		rows[r] = []byte(strings.Repeat(" ", s.Width))
+	}
+	for p, b := range s.board {
+		if p < len(game) {
+			rows[b%s.Width][b/s.Width] = game[p]
+		}
+	}
+	board := make([]string, s.Width)
+	for r, row := range rows {
+		board[r] = string(row)
+	}
+	return board
+}
+
+// Givens counts the filled cells of a game, the shared ones of a samurai once
+func (s Shape) Givens(game string) int {
+	values, err := s.values(game)
+	if err != nil {
+		return 0
+	}
+	givens := 0
+	for _, v := range values {
+		if v != 0 {
+			givens++
+		}
+	}
+	return givens
+}
+
+// values reads a game string into its board cells
+func (s Shape) values(game string) ([]int, error) {
+	if len(game) != s.Len() {
+		return nil, fmt.Errorf("expected %d cells, got %d", s.Len(), len(game))
+	}
+	values := make([]int, s.Width*s.Width)
+	for p, b := range s.board {
+		v := 0
+		switch c := game[p]; {
+		case c >= '1' && int(c-'0') <= s.Size:
+			v = int(c - '0')
+		case c != '.':
+			return nil, fmt.Errorf("cell %d is %q, not a digit from 1 to %d or '.'", p+1, c, s.Size)
+		}
+		if values[b] != 0 && v != 0 && values[b] != v {
+			return nil, fmt.Errorf("cell %d is %d in one grid and %d in another", p+1, values[b], v)
+		}
+		if v != 0 {
+			values[b] = v
+		}
+	}
+	return values, nil
+}
+
+// format writes board cells as a game string
+func (s Shape) format(values []int) string {
+	out := make([]byte, len(s.board))
+	for p, b := range s.board {
+		if values[b] == 0 {
+			out[p] = '.'
+		} else {
+			out[p] = byte('0' + values[b])
+		}
+	}
+	return string(out)
+}
+
+// Cage is a cage of a killer sudoku: its cells, positions in the game
+// string, hold different digits that add up to the sum
+type Cage struct {
+	Sum   int
+	Cells []int
+}
+
+// FormatCages writes cages as the stores and fixtures keep them, like
+// 10:0,1,9;7:2,3
+func FormatCages(cages []Cage) string {
+	parts := make([]string, len(cages))
+	for k, cage := range cages {
+		cells := make([]string, len(cage.Cells))
+		for i, c := range cage.Cells {
+			cells[i] = strconv.Itoa(c)
+		}
+		parts[k] = fmt.Sprintf("%d:%s", cage.Sum, strings.Join(cells, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// ParseCages reads the cages FormatCages writes
+func ParseCages(s string) ([]Cage, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var cages []Cage
+	for _, part := range strings.Split(s, ";") {
+		sum, cells, found := strings.Cut(part, ":")
+		if !found {
+			return nil, fmt.Errorf("cage %q has no sum", part)
+		}
+		var cage Cage
+		var err error
+		if cage.Sum, err = strconv.Atoi(sum); err != nil {
+			return nil, fmt.Errorf("cage %q: %w", part, err)
+		}
+		for _, cell := range strings.Split(cells, ",") {
+			c, err := strconv.Atoi(cell)
+			if err != nil {
+				return nil, fmt.Errorf("cage %q: %w", part, err)
+			}
+			cage.Cells = append(cage.Cells, c)
+		}
+		cages = append(cages, cage)
+	}
+	return cages, nil
+}
+
+// solver fills the board cells of a shape by backtracking, the cell with
+// the fewest candidates first, with the digits each unit and cage holds as
+// bits
+type solver struct {
+	shape     Shape
+	values    []int
+	used      []uint16 // digits of every unit
+	cages     []cageState
+	cageOf    []int // cage of every board cell, -1 for none
+	cells     []int
+	rng       *rand.Rand // tries the digits in random order, for filling
+	solutions int
+	solution  []int
+}
+
+// a cage while solving: its digits so far, their total and the empty cells
+type cageState struct {
+	sum    int
+	digits uint16
+	total  int
+	empty  int
+}
+
+// newSolver checks the givens and cages against each other
+func (s Shape) newSolver(values []int, cages []Cage) (*solver, error) {
+	sv := &solver{shape: s, values: make([]int, len(values)), used: make([]uint16, len(s.units)), cageOf: make([]int, len(values)), cells: s.Cells()}
+	for b := range sv.cageOf {
+		sv.cageOf[b] = -1
+	}
+	for k, cage := range cages {
+		sv.cages = append(sv.cages, cageState{sum: cage.Sum})
+		for _, p := range cage.Cells {
+			if p < 0 || p >= len(s.board) || sv.cageOf[s.board[p]] >= 0 {
+				return nil, fmt.Errorf("cage %d has a cell out of the grid or in another cage", k+1)
+			}
+			sv.cageOf[s.board[p]] = k
+			sv.cages[k].empty++
+		}
+	}
+	for _, b := range sv.cells {
+		if v := values[b]; v != 0 {
+			if sv.free(b)&(1<<v) == 0 {
+				return nil, fmt.Errorf("the given %d in row %d, column %d clashes with another given or its cage", v, b%s.Width+1, b/s.Width+1)
+			}
+			sv.set(b, v)
+		}
+	}
+	return sv, nil
+}
+
+func (sv *solver) set(b, v int) {
+	sv.values[b] = v
+	for _, u := range sv.shape.cellUnits[b] {
+		sv.used[u] |= 1 << v
+	}
+	if c := sv.cageOf[b]; c >= 0 {
+		sv.cages[c].digits |= 1 << v
+		sv.cages[c].total += v
+		sv.cages[c].empty--
+	}
+}
+
+func (sv *solver) unset(b, v int) {
+	sv.values[b] = 0
+	for _, u := range sv.shape.cellUnits[b] {
+		sv.used[u] &^= 1 << v
+	}
+	if c := sv.cageOf[b]; c >= 0 {
+		sv.cages[c].digits &^= 1 << v
+		sv.cages[c].total -= v
+		sv.cages[c].empty++
+	}
+}
+
+// free returns the digits still possible in board cell b
+func (sv *solver) free(b int) uint16 {
+	used := uint16(0)
+	for _, u := range sv.shape.cellUnits[b] {
+		used |= sv.used[u]
+	}
+	free := ^used & (1<<(sv.shape.Size+1) - 2)
+	c := sv.cageOf[b]
+	if c < 0 {
+		return free
+	}
+
+	// the rest of the cage has to make up the sum with other digits
+	cage := sv.cages[c]
+	free &^= cage.digits
+	left := cage.sum - cage.total
+	for v := 1; v <= sv.shape.Size; v++ {
+		if free&(1<<v) == 0 {
+			continue
+		}
+		rest, others := left-v, cage.empty-1
+		avail := (1<<(sv.shape.Size+1) - 2) &^ cage.digits &^ (1 << v)
+		low, high, n := 0, 0, 0
+		for d := 1; d <= sv.shape.Size && n < others; d++ {
+			if avail&(1<<d) != 0 {
+				low += d
+				n++
+			}
+		}
+		n = 0
+		for d := sv.shape.Size; d >= 1 && n < others; d-- {
+			if avail&(1<<d) != 0 {
+				high += d
+				n++
+			}
+		}
+		if n < others || rest < low || rest > high {
+			free &^= 1 << v
+		}
+	}
+	return free
+}
+
+// search counts the solutions up to limit and keeps the first
+func (sv *solver) search(limit int) bool {
+	best, bestCount := -1, 99
+	var bestFree uint16
+	for _, b := range sv.cells {
+		if sv.values[b] != 0 {
+			continue
+		}
+		free := sv.free(b)
+		if n := bitCount(free); n < bestCount {
+			best, bestCount, bestFree = b, n, free
+			if n <= 1 {
+				break
+			}
+		}
+	}
+	if best < 0 {
+		sv.solutions++
+		if sv.solution == nil {
+			sv.solution = append([]int(nil), sv.values...)
+		}
+		return sv.solutions >= limit
+	}
+	if bestCount > 1 {
+		// a digit with a single place in a unit goes there, one with none
+		// left means a dead end; a samurai's sparse grids need this
+		for u, unit := range sv.shape.units {
+			for v := 1; v <= sv.shape.Size; v++ {
+				if sv.used[u]&(1<<v) != 0 {
+					continue
+				}
+				place, places := -1, 0
+				for _, b := range unit {
+					if sv.values[b] == 0 && sv.free(b)&(1<<v) != 0 {
+						place = b
+						places++
+					}
+				}
+				if places == 0 {
+					return false
+				}
+				if places == 1 {
+					best, bestCount, bestFree = place, 1, 1<<v
+					break
+				}
+			}
+			if bestCount == 1 {
+				break
+			}
+		}
+	}
+
+	digits := make([]int, sv.shape.Size)
+	for k := range digits {
+		digits[k] = k + 1
+	}
+	if sv.rng != nil {
+		sv.rng.Shuffle(len(digits), func(a, b int) { digits[a], digits[b] = digits[b], digits[a] })
+	}
+	for _, v := range digits {
+		if bestFree&(1<<v) == 0 {
+			continue
+		}
+		sv.set(best, v)
+		stop := sv.search(limit)
+		sv.unset(best, v)
+		if stop {
+			return true
+		}
+	}
+	return false
+}
+
+// Solve returns the solution of a game of the shape, with the cages of a
+// killer, failing if it has none or more than one
+func (s Shape) Solve(game string, cages []Cage) (string, error) {
+	values, err := s.values(game)
+	if err != nil {
+		return "", err
+	}
+	sv, err := s.newSolver(values, cages)
+	if err != nil {
+		return "", err
+	}
+	sv.search(2)
+	switch sv.solutions {
+	case 0:
+		return "", errors.New("no solution")
+	case 1:
+		return s.format(sv.solution), nil
+	}
+	return "", errors.New("more than one solution")
+}
+
+// count counts the solutions of board cells that don't clash, up to limit
+func (s Shape) count(values []int, cages []Cage, limit int) int {
+	sv, err := s.newSolver(values, cages)
+	if err != nil {
+		return 0
+	}
+	sv.search(limit)
+	return sv.solutions
+}
+
+// fill returns a random solution of the empty board
+func (s Shape) fill(rng *rand.Rand) []int {
+	sv, _ := s.newSolver(make([]int, s.Width*s.Width), nil)
+	sv.rng = rng
+	sv.search(1)
+	return sv.solution
+}
+
+// cut cuts a killer's grid into cages of two to four cells, growing each
+// from a random cell into neighbours whose digits it doesn't hold yet. A
+// cell with no such neighbour left is a cage of its own.
+func (s Shape) cut(rng *rand.Rand, solution []int) []Cage {
+	n := s.Size
+	cageOf := make([]int, n*n)
+	for p := range cageOf {
+		cageOf[p] = -1
+	}
+	var cages []Cage
+	for _, start := range rng.Perm(n * n) {
+		if cageOf[start] >= 0 {
+			continue
+		}
+		k := len(cages)
+		cage := Cage{Sum: solution[s.board[start]], Cells: []int{start}}
+		cageOf[start] = k
+		digits := uint16(1) << solution[s.board[start]]
+		for size := 2 + rng.Intn(3); len(cage.Cells) < size; {
+			var next []int
+			for _, p := range cage.Cells {
+				col, row := p/n, p%n
+				for _, q := range [][2]int{{col - 1, row}, {col + 1, row}, {col, row - 1}, {col, row + 1}} {
+					if q[0] < 0 || q[0] >= n || q[1] < 0 || q[1] >= n {
+						continue
+					}
+					if p := q[0]*n + q[1]; cageOf[p] < 0 && digits&(1<<solution[s.board[p]]) == 0 {
+						next = append(next, p)
+					}
+				}
+			}
+			if len(next) == 0 {
+				break
+			}
+			p := next[rng.Intn(len(next))]
+			cageOf[p] = k
+			cage.Cells = append(cage.Cells, p)
+			cage.Sum += solution[s.board[p]]
+			digits |= 1 << solution[s.board[p]]
+		}
+		sort.Ints(cage.Cells)
+		cages = append(cages, cage)
+	}
+	sort.Slice(cages, func(a, b int) bool { return cages[a].Cells[0] < cages[b].Cells[0] })
+	return cages
+}
+
+// Puzzle is a generated sudoku of any shape
+type Puzzle struct {
+	Game     string
+	Solution string
+	Cages    []Cage // of a killer
+	Givens   int
+	Score    int // the empty cells, Rate only knows classic 9 x 9 grids
+}
+
+// variantFloors are the share of its cells a puzzle of another shape than
+// classic 9 x 9 keeps as givens at least. Rate's techniques are those of
+// the classic grid, so these puzzles are as hard as they are empty: a
+// killer's cages give away more than the givens of the other variants.
+var variantFloors = map[string]map[string]float64{
+	"classic": {"simple": 0.5, "easy": 0.4, "intermediate": 0.3},
+	"samurai": {"simple": 0.5, "easy": 0.4, "intermediate": 0.3},
+	"killer":  {"simple": 0.3, "easy": 0.15, "intermediate": 0.05},
+}
+
+// Generate makes a puzzle of the shape: a random solution, cut into cages
+// for a killer, with givens removed in random order as long as the
+// solution stays unique and the puzzle keeps the givens its difficulty
+// asks for. Expert and any puzzles keep as few as they can. Classic 9 x 9
+// puzzles are rated, see the package's Generate. It stops with the
+// context's error when cancelled.
+func (s Shape) Generate(ctx context.Context, rng *rand.Rand, difficulty string) (Puzzle, error) {
+	if err := ctx.Err(); err != nil {
+		return Puzzle{}, err
+	}
+	solution := s.fill(rng)
+	var cages []Cage
+	if s.Variant == "killer" {
+		cages = s.cut(rng, solution)
+	}
+
+	cells := s.Cells()
+	minGivens := int(math.Ceil(variantFloors[s.Variant][difficulty] * float64(len(cells))))
+	puzzle := append([]int(nil), solution...)
+	givens := len(cells)
+	for _, k := range rng.Perm(len(cells)) {
+		if err := ctx.Err(); err != nil {
+			return Puzzle{}, err
+		}
+		if givens-1 < minGivens {
+			break
+		}
+		b := cells[k]
+		puzzle[b] = 0
+		if s.count(puzzle, cages, 2) != 1 {
+			puzzle[b] = solution[b]
+		} else {
+			givens--
+		}
+	}
+	return Puzzle{Game: s.format(puzzle), Solution: s.format(solution), Cages: cages, Givens: givens, Score: len(cells) - givens}, nil
+}
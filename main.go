@@ -4,68 +4,128 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/jung-kurt/gofpdf"
+	"github.com/schokotets/drawsudokus/internal/config"
+	"github.com/schokotets/drawsudokus/internal/printpdf"
 )
 
-type difficultyValue struct {
-	Difficulty *string
-}
+var (
+	// qqwing is not installed or can't be run
+	ErrGeneratorUnavailable = errors.New("sudoku generator unavailable")
+	// qqwing made fewer sudokus than the pages need
+	ErrNotEnoughPuzzles = errors.New("not enough puzzles")
+	// the pdf can't be drawn or written
+	ErrRender = errors.New("rendering the pdf")
+	// the options can't work together, like a layout too dense for large print
+	ErrUsage = errors.New("invalid command line options")
+)
 
-func (d difficultyValue) String() string {
-	if d.Difficulty != nil {
-		return *d.Difficulty
+// exitCode gives every kind of error its own exit status, the same ones
+// the programs in internal use
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrGeneratorUnavailable):
+		return 3
+	case errors.Is(err, ErrNotEnoughPuzzles):
+		return 4
+	case errors.Is(err, ErrRender):
+		return 6
+	case errors.Is(err, ErrUsage):
+		return 2
 	}
-	return "any"
+	return 1
 }
 
-func (d difficultyValue) Set(s string) error {
-	difficulty := strings.ToLower(s)
-	switch difficulty {
-	case "intermediate", "simple", "easy", "expert", "any":
-		*d.Difficulty = difficulty
-		return nil
-	}
-	return errors.New("invalid difficulty value")
+// fail prints the error and exits with its status
+func fail(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(exitCode(err))
 }
 
 func main() {
+	settings, _, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+
 	nxPtr := flag.Int("nx", 2, "number of sudokus put horizontally")
 	nyPtr := flag.Int("ny", 1, "number of sudokus put vertically")
 	nPages := flag.Int("np", 1, "number of sudoku pages to generate")
 
 	difficulty := "any"
-	flag.Var(&difficultyValue{&difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+	flag.Var(&config.DifficultyValue{Difficulty: &difficulty}, "difficulty", "one of simple, easy, intermediate, expert, any")
+
+	output := flag.String("output", settings["output.dir"], "directory to write the pdf to")
+	background := flag.String("background", settings["theme.background"], "image drawn behind every page")
+	font := flag.String("font", settings["fonts.family"], "one of the pdf core fonts Helvetica, Times, Courier")
+	bleed := flag.Float64("bleed", 0, "bleed in mm around every page, the background is drawn into it")
+	marks := flag.Bool("marks", false, "draw crop and registration marks around the bleed")
+	largePrint := flag.Bool("largeprint", false, "large print edition: one sudoku a page unless -nx and -ny are given, big digits, heavy lines, no background")
+	minDigit := flag.Float64("mindigit", 24, "smallest digit size in points a large print layout may use")
 
 	flag.Parse()
 
 	nx := *nxPtr
 	ny := *nyPtr
 	np := *nPages
+
+	if *largePrint {
+		grid := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { grid[f.Name] = true })
+		if !grid["nx"] {
+			nx = 1
+		}
+		if !grid["ny"] {
+			ny = 1
+		}
+		// the page of createPDF, the bleed is around it
+		_, width, height := printpdf.New("L", "A5", printpdf.Options{})
+		if size := digitPoints(gridSize(width, height, nx, ny)); size < *minDigit {
+			fail(fmt.Errorf("%w: %d x %d sudokus a page have %.1f point digits, large print needs at least %g", ErrUsage, nx, ny, size, *minDigit))
+		}
+	}
 	n := nx * ny * np
 
 	fmt.Printf("Generating %d %s Sudokus in a %d x %d grid\n", n, difficulty, nx, ny)
 
-	sudokus := generateSudokus(n, difficulty)
+	sudokus, err := generateSudokus(n, difficulty)
+	if err != nil {
+		fail(err)
+	}
 
 	timestamp := time.Now().Format("20060102-150405")
 
-	filename := fmt.Sprintf("sudokus/sudokus-%v-%dx%d-%s.pdf", timestamp, nx, ny, difficulty)
-	createPDF(sudokus, timestamp, nx, ny, filename, np)
+	edition := ""
+	if *largePrint {
+		edition = "-largeprint"
+	}
+	filename := filepath.Join(*output, fmt.Sprintf("sudokus-%v-%dx%d-%s%s.pdf", timestamp, nx, ny, difficulty, edition))
+	err = createPDF(sudokus, timestamp, nx, ny, filename, np, pdfOptions{background: *background, font: *font, bleed: *bleed, marks: *marks, largePrint: *largePrint})
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Wrote sudokus to file %s\n", filename)
 }
 
-func generateSudokus(amount int, difficulty string) []string {
+func generateSudokus(amount int, difficulty string) ([]string, error) {
+	if _, err := exec.LookPath("qqwing"); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGeneratorUnavailable, err)
+	}
 	out, err := exec.Command("sh", "-c", fmt.Sprintf("qqwing --generate %d --one-line --difficulty %s", amount, difficulty)).Output()
 	if err != nil {
-		fmt.Printf("Error: %v", err)
-		panic(err)
-		// return nil
+		return nil, fmt.Errorf("%w: qqwing --generate: %w", ErrGeneratorUnavailable, err)
 	}
 	fmt.Println(string(out))
-	return strings.Split(strings.Trim(string(out), "\n"), "\n")
+	sudokus := strings.Split(strings.Trim(string(out), "\n"), "\n")
+	if len(sudokus) < amount {
+		return nil, fmt.Errorf("%w: qqwing made %d of %d sudokus", ErrNotEnoughPuzzles, len(sudokus), amount)
+	}
+	return sudokus, nil
 }
 
 func smaller(a, b float64) float64 {
@@ -75,50 +135,87 @@ func smaller(a, b float64) float64 {
 	return b
 }
 
-func createPDF(sudokus []string, timestamp string, nx, ny int, filename string, np int) {
+// options of a pdf beyond the number of grids on a page
+type pdfOptions struct {
+	background string // image drawn behind every page
+	font       string
+	bleed      float64 // mm added around the trimmed page
+	marks      bool    // crop and registration marks outside the bleed
+	largePrint bool    // heavy lines, black on white, no background
+}
+
+// margin of the pages createPDF draws, in mm
+const pageMargin = 5.
+
+// gridSize is the side of the grids when nx by ny of them share a page
+func gridSize(width, height float64, nx, ny int) float64 {
+	drawingWidth := width - 5*pageMargin   // 2 for the heading + 1 left + 1 right
+	drawingHeight := height - 4*pageMargin // 3 top, 1 bottom
+	return smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85
+}
+
+// digitPoints is the font size of the digits in a grid of side L
+func digitPoints(L float64) float64 {
+	return L / 9 * 0.8 * 2.83 //2.83 points is a mm
+}
+
+func createPDF(sudokus []string, timestamp string, nx, ny int, filename string, np int, options pdfOptions) error {
 
 	sudokuIndex := 0
-	backgroundImage := "4.jpg"
 	title := "Killer Sudoku - Volume #5 - Easy"
 
-	pdf := gofpdf.New("L", "mm", "A5", "")
+	font := options.font
+	bleed := options.bleed
+
+	pdf, width, height := printpdf.New("L", "A5", printpdf.Options{Bleed: bleed, Marks: options.marks})
 	//  pages for prelim
 	pdf.AddPage()
-	width, height := pdf.GetPageSize()
-	margin := 5. //5 mm
+	margin := pageMargin
 
 	drawingWidth := width - 5*margin   // 2 for the heading + 1 left + 1 right
 	drawingHeight := height - 4*margin // 3 top, 1 bottom
 
 	offsetY := (height - drawingHeight) / 1.2
 
-	L := smaller(drawingWidth/float64(nx), drawingHeight/float64(ny)) * 0.85 //small sudoku length
+	L := gridSize(width, height, nx, ny) //small sudoku length
 	fieldL := L / 9
 
 	thinLineWidth := L / 300
 	thickLineWidth := L / 120
+	numberStyle := "IB"
+	titleStyle, titleSize := "I", 10.
+	if options.largePrint {
+		// lines that stay visible to weak eyes, and an upright number
+		thinLineWidth = L / 150
+		thickLineWidth = L / 50
+		numberStyle = "B"
+		titleStyle, titleSize = "B", 18
+	}
 
-	// create a few pages with background image
-	for v := 0; v < 2; v++ {
+	// create a few pages with background image, large print has none
+	for v := 0; v < 2 && !options.largePrint; v++ {
 		pdf.AddPage()
-		pdf.Image(backgroundImage, 0, 0, width, height, false, "", 0, "")
+		pdf.Image(options.background, -bleed, -bleed, width+2*bleed, height+2*bleed, false, "", 0, "")
 	}
 
 	for W := 0; W < np; W++ {
 
 		pdf.AddPage()
-		pdf.Image(backgroundImage, 0, 0, width, height, false, "", 0, "")
+		if !options.largePrint {
+			pdf.Image(options.background, -bleed, -bleed, width+2*bleed, height+2*bleed, false, "", 0, "")
+		}
 		pdf.SetMargins(0, 0, 0)
 		pdf.SetAutoPageBreak(false, 0)
 		pdf.SetDrawColor(0, 0, 0)
+		pdf.SetTextColor(0, 0, 0)
 
-		pdf.SetFont("Helvetica", "", 12)
+		pdf.SetFont(font, "", 12)
 
 		//draw title
 		pdf.MoveTo(0, height+3*margin)
 		pdf.TransformBegin()
 		pdf.TransformRotate(90, 0, height)
-		pdf.SetFont("Helvetica", "I", 10)
+		pdf.SetFont(font, titleStyle, titleSize)
 		pdf.CellFormat(height, 2*margin, title, "", 1, "MC", false, 0, "")
 		pdf.TransformEnd()
 
@@ -129,12 +226,12 @@ func createPDF(sudokus []string, timestamp string, nx, ny int, filename string,
 				y0 := offsetY + float64(Y)/float64(ny)*drawingHeight + (drawingHeight/float64(ny)-L)/2
 
 				// write game number on top
-				pdf.SetFont("Helvetica", "IB", fieldL*0.8*2.83)
+				pdf.SetFont(font, numberStyle, digitPoints(L))
 				pdf.MoveTo(x0, y0-3*margin)
 				pdf.CellFormat(L, 3*margin, fmt.Sprintf(" #%d ", sudokuIndex+1), "T", 0, "MC", false, 0, "")
 
 				// set font for sudoku
-				pdf.SetFont("Helvetica", "", fieldL*0.8*2.83) //2.83 points is a mm
+				pdf.SetFont(font, "", digitPoints(L))
 
 				// draw horizontal lines
 				for ly := 0; ly < 10; ly++ {
@@ -176,17 +273,19 @@ func createPDF(sudokus []string, timestamp string, nx, ny int, filename string,
 			}
 			// Page number
 			pdf.MoveTo(0, height-4*margin)
-			pdf.SetFont("Helvetica", "", fieldL*0.8*2.83/1.5)
-			pdf.CellFormat(0, 2*margin, fmt.Sprintf("P%d", pdf.PageNo()), "0", 0, "MC", false, 0, "")
+			pdf.SetFont(font, "", digitPoints(L)/1.5)
+			pdf.CellFormat(width, 2*margin, fmt.Sprintf("P%d", pdf.PageNo()), "0", 0, "MC", false, 0, "")
 
 		}
 
 	}
 
-	err := pdf.OutputFileAndClose(filename)
+	data, err := printpdf.Output(pdf)
+	if err == nil {
+		err = os.WriteFile(filename, data, 0644)
+	}
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Printf("Wrote sudokus to file %s\n", filename)
+		return fmt.Errorf("%w: %s: %w", ErrRender, filename, err)
 	}
+	return nil
 }